@@ -0,0 +1,182 @@
+package sj
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	WrongPasswordError = NewAPIError(http.StatusForbidden, "wrong_password", "Wrong password")
+)
+
+type (
+	ChangePasswordRequest struct {
+		Password    string
+		NewPassword string
+	}
+
+	ChangePasswordBody struct {
+		Password    *string
+		NewPassword *string
+	}
+
+	NameBody struct {
+		Name *string
+	}
+)
+
+func ParseNameRequest(r *http.Request) (string, error) {
+	body, err := DecodeRequest[NameBody](r)
+	if err != nil {
+		return "", err
+	}
+
+	v := &Validator{}
+	name := v.RequiredString("Name", body.Name)
+
+	return name, v.Err()
+}
+
+func ParseChangePasswordRequest(r *http.Request) (ChangePasswordRequest, error) {
+	body, err := DecodeRequest[ChangePasswordBody](r)
+	if err != nil {
+		return ChangePasswordRequest{}, err
+	}
+
+	v := &Validator{}
+	change := ChangePasswordRequest{
+		Password:    v.RequiredString("Password", body.Password),
+		NewPassword: v.RequiredString("NewPassword", body.NewPassword),
+	}
+
+	err = v.Err()
+	if err != nil {
+		return ChangePasswordRequest{}, err
+	}
+
+	return change, nil
+}
+
+func RenameUserHandler(c *gin.Context, app AppContext) error {
+	name, err := ParseNameRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	err = app.RegistrationPolicy().CheckName(name)
+	if err != nil {
+		return err
+	}
+
+	store := app.Store()
+	user, err := ReadSessionUser(c, store)
+	if err != nil {
+		return err
+	}
+
+	// The store reports a taken name with UserExistsError
+	change := ChangeUser{
+		Name: name,
+	}
+	err = store.UpdateUser(user.Id, change)
+	if err != nil {
+		return err
+	}
+
+	data := IDData{
+		ID: user.Id.Hex(),
+	}
+	c.JSON(http.StatusOK, NewSuccessResponse(data))
+
+	return nil
+}
+
+// Changes the password of the session user. All other sessions of the
+// user are removed, the current one stays valid.
+func ChangePasswordHandler(c *gin.Context, app AppContext) error {
+	change, err := ParseChangePasswordRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	session, err := ReadAuthSession(c)
+	if err != nil {
+		return err
+	}
+
+	store := app.Store()
+	user, err := ReadSessionUser(c, store)
+	if err != nil {
+		return err
+	}
+
+	passwords := app.Passwords()
+	ok, _, err := passwords.Verify(change.Password, user.Password())
+	if err != nil && err != UnknownHashError {
+		return err
+	}
+
+	if !ok {
+		return WrongPasswordError
+	}
+
+	err = app.RegistrationPolicy().CheckPassword(user.Name, change.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	hash, err := passwords.Hash(change.NewPassword)
+	if err != nil {
+		return err
+	}
+
+	err = NewJournal(store).UpdateAndRevokeSessions(user.Id, ChangeUser{Pass: hash}, session.Token)
+	if err != nil {
+		return err
+	}
+
+	data := IDData{
+		ID: user.Id.Hex(),
+	}
+	c.JSON(http.StatusOK, NewSuccessResponse(data))
+
+	return nil
+}
+
+// Removes the session user, the password has to be confirmed
+func RemoveUserHandler(c *gin.Context, app AppContext) error {
+	pass, err := ParsePasswordRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	store := app.Store()
+	user, err := ReadSessionUser(c, store)
+	if err != nil {
+		return err
+	}
+
+	ok, _, err := app.Passwords().Verify(pass, user.Password())
+	if err != nil && err != UnknownHashError {
+		return err
+	}
+
+	if !ok {
+		return WrongPasswordError
+	}
+
+	err = NewJournal(store).RemoveUser(user.Id)
+	if err != nil {
+		return err
+	}
+
+	RemoveXSRFCookie(c)
+
+	data := IDData{
+		ID: user.Id.Hex(),
+	}
+	c.JSON(http.StatusOK, NewSuccessResponse(data))
+
+	return nil
+}
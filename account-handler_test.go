@@ -0,0 +1,209 @@
+package sj
+
+import "testing"
+
+func Test_PUT_AccountName_FailUserExists(t *testing.T) {
+	env := NewTestEnv(t)
+	store := env.Store
+	defer env.Close()
+
+	user, session, _ := NewTestDBEnv(t, store)
+
+	_, err := store.NewUser(User{Name: "otherLover"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := `
+	{
+		"Data": {
+			"Name": "otherLover"
+		}
+	}`
+
+	req := env.Request(body)
+
+	resp := req.SendWithToken("PUT", "/account/name", session.Token)
+
+	expectResp := FailResponse{
+		Status: "fail",
+		Err:    UserExistsError.Error(),
+	}
+	err = EqualFailResponse(resp.Body, expectResp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := store.ReadUser(user.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Name != user.Name {
+		t.Fatal("Expect", user.Name, "was", result.Name)
+	}
+}
+
+func Test_PUT_AccountPassword_OK(t *testing.T) {
+	env := NewTestEnv(t)
+	store := env.Store
+	defer env.Close()
+
+	user := env.NewUser("greatLover99", "secret")
+	id := user.Id
+	session := env.NewSession(user, "123")
+	other := env.NewSession(user, "456")
+
+	body := `
+	{
+		"Data": {
+			"Password": "wrong",
+			"NewPassword": "moreSecret"
+		}
+	}`
+
+	req := env.Request(body)
+
+	resp := req.SendWithToken("PUT", "/account/password", session.Token)
+
+	expectResp := FailResponse{
+		Status: "fail",
+		Err:    WrongPasswordError.Error(),
+	}
+	err := EqualFailResponse(resp.Body, expectResp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req = env.Request(`
+		{
+			"Data": {
+				"Password": "secret",
+				"NewPassword": "moreSecret"
+			}
+		}`)
+
+	resp = req.SendWithToken("PUT", "/account/password", session.Token)
+
+	expectSuccess := NewSuccessResponse(IDData{ID: id.Hex()})
+	if !EqualSuccessResponse(expectSuccess, resp.Body, ExistsIDField) {
+		t.Fatal("Expect", expectSuccess, "was", resp.Body)
+	}
+
+	result, err := store.ReadUser(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok, _, err := env.App.Passwords().Verify("moreSecret", result.Pass)
+	if err != nil || !ok {
+		t.Fatal("Expect the new password to match", err)
+	}
+
+	_, err = store.ReadSession(other.Token)
+	if err != NotFoundError {
+		t.Fatal("Expect", NotFoundError, "was", err)
+	}
+
+	_, err = store.ReadSession(session.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_DELETE_Account_OK(t *testing.T) {
+	env := NewTestEnv(t)
+	store := env.Store
+	defer env.Close()
+
+	user, session, sList := NewTestDBEnv(t, store)
+
+	episode := Episode{
+		SeriesID: sList[0].ID,
+		Title:    "Descenso",
+		Session:  1,
+		Episode:  1,
+	}
+	episodeID, err := store.NewEpisode(episode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.WatchEpisode(user.Id, episodeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.UpdateUser(user.Id, ChangeUser{Pass: NewTestPasswordHash(t, "secret")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := env.Request(`{"Data": {"Password": "secret"}}`)
+
+	resp := req.SendWithToken("DELETE", "/account", session.Token)
+
+	expectResp := NewSuccessResponse(IDData{ID: user.Id.Hex()})
+	if !EqualSuccessResponse(expectResp, resp.Body, ExistsIDField) {
+		t.Fatal("Expect", expectResp, "was", resp.Body)
+	}
+
+	_, err = store.ReadUser(user.Id)
+	if err != NotFoundError {
+		t.Fatal("Expect", NotFoundError, "was", err)
+	}
+
+	_, err = store.ReadSession(session.Token)
+	if err != NotFoundError {
+		t.Fatal("Expect", NotFoundError, "was", err)
+	}
+
+	// Nobody else followed the series
+	for _, s := range sList {
+		_, err := store.ReadSeries(s.ID)
+		if err != NotFoundError {
+			t.Fatal("Expect", NotFoundError, "was", err)
+		}
+	}
+
+	_, err = store.ReadEpisode(episodeID)
+	if err != NotFoundError {
+		t.Fatal("Expect", NotFoundError, "was", err)
+	}
+}
+
+func Test_DELETE_Account_FailWrongPassword(t *testing.T) {
+	env := NewTestEnv(t)
+	store := env.Store
+	defer env.Close()
+
+	user, session, _ := NewTestDBEnv(t, store)
+
+	err := store.UpdateUser(user.Id, ChangeUser{Pass: NewTestPasswordHash(t, "secret")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := env.Request(`{"Data": {"Password": "wrong"}}`)
+
+	resp := req.SendWithToken("DELETE", "/account", session.Token)
+
+	expectResp := FailResponse{
+		Status: "fail",
+		Err:    WrongPasswordError.Error(),
+	}
+	err = EqualFailResponse(resp.Body, expectResp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.ReadUser(user.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.ReadSession(session.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,275 @@
+package sj
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	UserRole  = "user"
+	AdminRole = "admin"
+)
+
+var (
+	AccountDisabledError = NewAPIError(http.StatusForbidden, "account_disabled", "Account is disabled")
+	OwnAccountError      = NewAPIError(http.StatusForbidden, "own_account", "Cannot change the own account")
+)
+
+type (
+	AdminUserData struct {
+		ID          string
+		Name        string
+		Role        string
+		Disabled    bool
+		SeriesCount int
+	}
+
+	usersByName []User
+
+	DisabledBody struct {
+		Disabled *bool
+	}
+
+	RoleBody struct {
+		Role string
+	}
+)
+
+func (l usersByName) Len() int {
+	return len(l)
+}
+
+func (l usersByName) Less(x, y int) bool {
+	return l[x].Name < l[y].Name
+}
+
+func (l usersByName) Swap(x, y int) {
+	l[x], l[y] = l[y], l[x]
+}
+
+func ValidRole(role string) bool {
+	return role == UserRole || role == AdminRole
+}
+
+// Users without a role are users from before the roles
+func (u User) HasRole(role string) bool {
+	if u.Role == "" {
+		return role == UserRole
+	}
+
+	return u.Role == role
+}
+
+func (u User) AdminData() AdminUserData {
+	role := u.Role
+	if role == "" {
+		role = UserRole
+	}
+
+	return AdminUserData{
+		ID:          u.Id.Hex(),
+		Name:        u.Name,
+		Role:        role,
+		Disabled:    u.Disabled,
+		SeriesCount: len(u.Series),
+	}
+}
+
+// AdminAuth runs behind SessionAuth and lets only enabled admins pass
+func AdminAuth(app AppContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := ReadSessionUser(c, app.Store())
+		if err != nil {
+			AbortWithFail(c, err)
+			return
+		}
+
+		if user.Disabled || !user.HasRole(AdminRole) {
+			AbortWithFail(c, NewForbiddenError("Admin role required"))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// PromoteAdmins gives the users with the names the admin role, it is run
+// at the start of the app. Names without a user are skipped.
+func PromoteAdmins(store Store, names []string) error {
+	for _, name := range names {
+		user, err := store.FindUser(name)
+		if err == NotFoundError {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if user.HasRole(AdminRole) {
+			continue
+		}
+
+		err = store.UpdateUser(user.Id, ChangeUser{Role: AdminRole})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func ParseDisabledRequest(r *http.Request) (bool, error) {
+	body, err := DecodeRequest[DisabledBody](r)
+	if err != nil {
+		return false, err
+	}
+
+	if body.Disabled == nil {
+		return false, NewMissingFieldError("Disabled")
+	}
+
+	return *body.Disabled, nil
+}
+
+func ParseRoleRequest(r *http.Request) (string, error) {
+	body, err := DecodeRequest[RoleBody](r)
+	if err != nil {
+		return "", err
+	}
+
+	v := &Validator{}
+	v.Required("Role", body.Role)
+	if body.Role != "" && !ValidRole(body.Role) {
+		msg := fmt.Sprintf("Wrong role %v", body.Role)
+		v.Add("Role", WrongFieldCode, msg)
+	}
+
+	return body.Role, v.Err()
+}
+
+// Reads the user of the id parameter, admins cannot change their own
+// account with the admin API so they cannot lock themselves out.
+func readOtherUser(c *gin.Context, store Store) (User, error) {
+	id, err := ParseIDParam(c, "id")
+	if err != nil {
+		return User{}, err
+	}
+
+	admin, err := ReadSessionUser(c, store)
+	if err != nil {
+		return User{}, err
+	}
+
+	if admin.Id == id {
+		return User{}, OwnAccountError
+	}
+
+	return store.ReadUser(id)
+}
+
+func ReadUsersHandler(c *gin.Context, app AppContext) error {
+	users, err := app.Store().ReadUsers()
+	if err != nil {
+		return err
+	}
+
+	data := []AdminUserData{}
+	for _, u := range users {
+		data = append(data, u.AdminData())
+	}
+	c.JSON(http.StatusOK, NewSuccessResponse(data))
+
+	return nil
+}
+
+// Disables or enables an account, a disabled user loses his sessions and
+// API tokens and cannot login until he is enabled again.
+func DisableUserHandler(c *gin.Context, app AppContext) error {
+	disabled, err := ParseDisabledRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	store := app.Store()
+	user, err := readOtherUser(c, store)
+	if err != nil {
+		return err
+	}
+
+	change := ChangeUser{
+		Disabled: &disabled,
+	}
+	if disabled {
+		err = NewJournal(store).UpdateAndRevokeUser(user.Id, change)
+	} else {
+		err = store.UpdateUser(user.Id, change)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	user.Disabled = disabled
+	c.JSON(http.StatusOK, NewSuccessResponse(user.AdminData()))
+
+	return nil
+}
+
+// Sets a new password for the user and removes his sessions and API tokens
+func ResetPasswordHandler(c *gin.Context, app AppContext) error {
+	pass, err := ParsePasswordRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	store := app.Store()
+	user, err := readOtherUser(c, store)
+	if err != nil {
+		return err
+	}
+
+	err = app.RegistrationPolicy().CheckPassword(user.Name, pass)
+	if err != nil {
+		return err
+	}
+
+	hash, err := app.Passwords().Hash(pass)
+	if err != nil {
+		return err
+	}
+
+	err = NewJournal(store).UpdateAndRevokeUser(user.Id, ChangeUser{Pass: hash})
+	if err != nil {
+		return err
+	}
+
+	c.JSON(http.StatusOK, NewSuccessResponse(user.AdminData()))
+
+	return nil
+}
+
+func ChangeRoleHandler(c *gin.Context, app AppContext) error {
+	role, err := ParseRoleRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	store := app.Store()
+	user, err := readOtherUser(c, store)
+	if err != nil {
+		return err
+	}
+
+	err = store.UpdateUser(user.Id, ChangeUser{Role: role})
+	if err != nil {
+		return err
+	}
+
+	user.Role = role
+	c.JSON(http.StatusOK, NewSuccessResponse(user.AdminData()))
+
+	return nil
+}
@@ -0,0 +1,215 @@
+package sj
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// Creates an admin with the session token "admin"
+func NewTestAdmin(env *TestEnv) User {
+	admin := env.NewUser("admin", "admin!secret")
+
+	err := PromoteAdmins(env.Store, []string{"admin", "nobody"})
+	if err != nil {
+		env.t.Fatal(err)
+	}
+
+	env.NewSession(admin, "admin")
+
+	return admin
+}
+
+func Test_AdminAuth_FailNoAdmin(t *testing.T) {
+	env := NewTestEnv(t)
+	store := env.Store
+	defer env.Close()
+
+	_, session, _ := NewTestDBEnv(t, store)
+
+	req := env.Request("")
+	resp := req.SendWithToken("GET", "/admin/users", session.Token)
+	if resp.Code != http.StatusForbidden {
+		t.Fatal("Expect", http.StatusForbidden, "was", resp.Code)
+	}
+}
+
+func Test_GET_AdminUsers_OK(t *testing.T) {
+	env := NewTestEnv(t)
+	store := env.Store
+	defer env.Close()
+
+	user, _, sList := NewTestDBEnv(t, store)
+	admin := NewTestAdmin(env)
+
+	req := env.Request("")
+	resp := req.SendWithToken("GET", "/admin/users", "admin")
+
+	result := struct {
+		Status string
+		Data   []AdminUserData
+	}{}
+	err := json.Unmarshal(resp.Body.Bytes(), &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []AdminUserData{
+		{
+			ID:          admin.Id.Hex(),
+			Name:        admin.Name,
+			Role:        AdminRole,
+			SeriesCount: 0,
+		},
+		{
+			ID:          user.Id.Hex(),
+			Name:        user.Name,
+			Role:        UserRole,
+			SeriesCount: len(sList),
+		},
+	}
+
+	if len(result.Data) != len(expect) {
+		t.Fatal("Expect", expect, "was", resp.Body)
+	}
+
+	for i, d := range expect {
+		if result.Data[i] != d {
+			t.Fatal("Expect", d, "was", result.Data[i])
+		}
+	}
+}
+
+func Test_PUT_AdminDisabled_OK(t *testing.T) {
+	env := NewTestEnv(t)
+	store := env.Store
+	defer env.Close()
+
+	user := env.NewUser("greatLover99", "love!machine")
+	id := user.Id
+	session := env.NewSession(user, "123")
+	NewTestAdmin(env)
+
+	req := env.Request(`{"Data": {"Disabled": true}}`)
+	resp := req.SendWithToken("PUT", "/admin/users/"+id.Hex()+"/disabled", "admin")
+	if resp.Code != http.StatusOK {
+		t.Fatal("Expect", http.StatusOK, "was", resp.Code, resp.Body)
+	}
+
+	_, err := store.ReadSession(session.Token)
+	if err != NotFoundError {
+		t.Fatal("Expect", NotFoundError, "was", err)
+	}
+
+	_, err = SendTestLogin(env, "")
+	if err == nil || err.Error() != AccountDisabledError.Error() {
+		t.Fatal("Expect", AccountDisabledError, "was", err)
+	}
+
+	req = env.Request(`{"Data": {"Disabled": false}}`)
+	resp = req.SendWithToken("PUT", "/admin/users/"+id.Hex()+"/disabled", "admin")
+	if resp.Code != http.StatusOK {
+		t.Fatal("Expect", http.StatusOK, "was", resp.Code, resp.Body)
+	}
+
+	_, err = SendTestLogin(env, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// The session was created before the user was disabled without a revoke
+func Test_SessionAuth_FailDisabledUser(t *testing.T) {
+	env := NewTestEnv(t)
+	store := env.Store
+	defer env.Close()
+
+	user := env.NewUser("greatLover99", "love!machine")
+	session := env.NewSession(user, "123")
+
+	disabled := true
+	err := store.UpdateUser(user.Id, ChangeUser{Disabled: &disabled})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := env.Request("")
+	resp := req.SendWithToken("GET", "/sessions", session.Token)
+	if resp.Code != http.StatusUnauthorized {
+		t.Fatal("Expect", http.StatusUnauthorized, "was", resp.Code, resp.Body)
+	}
+
+	req = env.Request("")
+	resp = req.SendWithToken("GET", "/users/"+user.Id.Hex()+"/series", session.Token)
+	if resp.Code != http.StatusUnauthorized {
+		t.Fatal("Expect", http.StatusUnauthorized, "was", resp.Code, resp.Body)
+	}
+}
+
+func Test_PUT_AdminPassword_FailOwnAccount(t *testing.T) {
+	env := NewTestEnv(t)
+	defer env.Close()
+
+	admin := NewTestAdmin(env)
+
+	req := env.Request(`{"Data": {"Password": "other!secret"}}`)
+	resp := req.SendWithToken("PUT", "/admin/users/"+admin.Id.Hex()+"/password", "admin")
+
+	expectResp := FailResponse{
+		Status: "fail",
+		Err:    OwnAccountError.Error(),
+	}
+	err := EqualFailResponse(resp.Body, expectResp)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_PUT_AdminPassword_OK(t *testing.T) {
+	env := NewTestEnv(t)
+	store := env.Store
+	defer env.Close()
+
+	user := env.NewUser("greatLover99", "love!machine")
+	id := user.Id
+	session := env.NewSession(user, "123")
+	NewTestAdmin(env)
+
+	token := APIToken{
+		UserID:  id,
+		Name:    "script",
+		Hash:    HashAPIToken("456"),
+		Scope:   ReadScope,
+		Created: time.Now(),
+	}
+	_, err := store.NewAPIToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := env.Request(`{"Data": {"Password": "other!machine"}}`)
+	resp := req.SendWithToken("PUT", "/admin/users/"+id.Hex()+"/password", "admin")
+	if resp.Code != http.StatusOK {
+		t.Fatal("Expect", http.StatusOK, "was", resp.Code, resp.Body)
+	}
+
+	_, err = store.ReadSession(session.Token)
+	if err != NotFoundError {
+		t.Fatal("Expect", NotFoundError, "was", err)
+	}
+
+	_, err = store.ReadAPIToken(token.Hash)
+	if err != NotFoundError {
+		t.Fatal("Expect", NotFoundError, "was", err)
+	}
+
+	entries, err := store.ReadJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 0 {
+		t.Fatal("Expect an empty journal was", entries)
+	}
+}
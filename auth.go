@@ -0,0 +1,153 @@
+package sj
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rrawrriw/angular-sauth-handler"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	XSRFTokenHeader = "X-XSRF-TOKEN"
+	SessionKey      = "Session"
+)
+
+// SessionAuth works like aauth.AngularAuth but reads the sessions from the
+// Store of the app, so it does not depend on a MongoDB. Sessions of
+// disabled users are rejected like BearerAuth rejects their tokens.
+func SessionAuth(app AppContext) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.Request.Header.Get(XSRFTokenHeader)
+		if token == "" {
+			AbortWithFail(c, NewUnauthorizedError("Missing session"))
+			return
+		}
+
+		session, err := app.Store().ReadSession(token)
+		if err != nil {
+			AbortWithFail(c, NewUnauthorizedError("Wrong session"))
+			return
+		}
+
+		if session.Expires.Before(app.Now()) {
+			AbortWithFail(c, NewUnauthorizedError("Wrong session"))
+			return
+		}
+
+		if !bson.IsObjectIdHex(session.UserID) {
+			AbortWithFail(c, NewUnauthorizedError("Wrong session"))
+			return
+		}
+
+		user, err := app.Store().ReadUser(bson.ObjectIdHex(session.UserID))
+		if err != nil || user.Disabled {
+			AbortWithFail(c, NewUnauthorizedError("Wrong session"))
+			return
+		}
+
+		c.Set(SessionKey, session)
+		c.Next()
+	}
+}
+
+// ReadAuthSession returns the session which SessionAuth or BearerAuth set
+func ReadAuthSession(c *gin.Context) (aauth.Session, error) {
+	session, err := aauth.ReadSession(c)
+	if err != nil {
+		return aauth.Session{}, NewUnauthorizedError("Cannot find session")
+	}
+
+	return session, nil
+}
+
+func ReadSessionUser(c *gin.Context, store Store) (User, error) {
+	session, err := ReadAuthSession(c)
+	if err != nil {
+		return User{}, err
+	}
+
+	if !bson.IsObjectIdHex(session.UserID) {
+		return User{}, NewUnauthorizedError("Wrong session")
+	}
+
+	user, err := store.ReadUser(bson.ObjectIdHex(session.UserID))
+	if err == NotFoundError {
+		return User{}, NewUnauthorizedError("Wrong session")
+	}
+
+	if err != nil {
+		return User{}, err
+	}
+
+	if user.Disabled {
+		return User{}, AccountDisabledError
+	}
+
+	return user, nil
+}
+
+// Returns the user of the session if the series is one of his series
+func ReadSeriesOwner(c *gin.Context, store Store, seriesID bson.ObjectId) (User, error) {
+	user, err := ReadSessionUser(c, store)
+	if err != nil {
+		return User{}, err
+	}
+
+	if !ContainsID(user.Series, seriesID) {
+		m := fmt.Sprintf("Cannot access %v", seriesID.Hex())
+		return User{}, NewForbiddenError(m)
+	}
+
+	return user, nil
+}
+
+// ReadSeriesEditor returns the session user if he owns the series. A series
+// whose owner no longer follows it can be changed by every follower.
+func ReadSeriesEditor(c *gin.Context, store Store, seriesID bson.ObjectId) (User, error) {
+	user, err := ReadSeriesOwner(c, store, seriesID)
+	if err != nil {
+		return User{}, err
+	}
+
+	series, err := store.ReadSeries(seriesID)
+	if err != nil {
+		return User{}, err
+	}
+
+	if series.Owner == "" || series.Owner == user.Id {
+		return user, nil
+	}
+
+	owner, err := store.ReadUser(series.Owner)
+	if err == NotFoundError || (err == nil && !ContainsID(owner.Series, seriesID)) {
+		return user, nil
+	}
+	if err != nil {
+		return User{}, err
+	}
+
+	m := fmt.Sprintf("Only the owner can change %v", seriesID.Hex())
+	return User{}, NewForbiddenError(m)
+}
+
+// AuthorizeSeriesOfUser allows the session user to read the series of the
+// owner if he is the owner or the owner shared them with him.
+func AuthorizeSeriesOfUser(c *gin.Context, store Store, ownerID bson.ObjectId) error {
+	user, err := ReadSessionUser(c, store)
+	if err != nil {
+		return err
+	}
+
+	if user.Id == ownerID {
+		return nil
+	}
+
+	_, err = store.ReadShare(ownerID, user.Id)
+	if err == NotFoundError {
+		m := fmt.Sprintf("Cannot access %v", ownerID.Hex())
+		return NewForbiddenError(m)
+	}
+
+	return err
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rrawrriw/sj"
+)
+
+const (
+	AppNamePrefix   = "SJ"
+	ShutdownTimeout = 10 * time.Second
+)
+
+func NewRouter(app sj.AppCtx) *gin.Engine {
+	router := gin.Default()
+
+	public := sj.LocalFile(app.Specs.PublicDir, false)
+	router.Use(sj.Serve("/", public))
+
+	sj.APIRoutes(router.Group("/api"), app)
+
+	return router
+}
+
+func main() {
+	app, err := sj.NewApp(AppNamePrefix)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	addr := fmt.Sprintf("%v:%v", app.Specs.Host, app.Specs.Port)
+	server := &http.Server{
+		Addr:    addr,
+		Handler: NewRouter(app),
+	}
+
+	go func() {
+		log.Println("Listen on", addr)
+		err := server.ListenAndServe()
+		if err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	// Recovers the runs NewApp left to other instances
+	stop := make(chan struct{})
+	go sj.NewJournal(app.Store()).RecoverEvery(sj.JournalGrace, app.Now, stop)
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+
+	log.Println("Shutdown server")
+	close(stop)
+
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+
+	err = server.Shutdown(ctx)
+	if err != nil {
+		log.Println(err)
+	}
+
+	// Closes the store and with it the AppCtx.MgoSession
+	err = app.Close()
+	if err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/rrawrriw/sj"
+)
+
+func NewTestApp(t *testing.T) sj.AppCtx {
+	dir, err := ioutil.TempDir("", "sj-public")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ioutil.WriteFile(path.Join(dir, "index.html"), []byte("sj"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := sj.AppCtx{
+		Specs: sj.Specs{
+			PublicDir: dir,
+		},
+		Backend: sj.NewMemStore(),
+	}
+
+	return app
+}
+
+func Test_NewRouter_OK(t *testing.T) {
+	app := NewTestApp(t)
+	defer os.RemoveAll(app.Specs.PublicDir)
+
+	router := NewRouter(app)
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || w.Body.String() != "sj" {
+		t.Fatal("Expect index.html was", w.Code, w.Body)
+	}
+
+	body := bytes.NewBufferString(`{"Data": {"Name": "greatLover99", "Password": "love!machine"}}`)
+	req, _ = http.NewRequest("POST", "/api/users", body)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	resp := sj.SuccessResponse{}
+	err := json.Unmarshal(w.Body.Bytes(), &resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Status != "success" {
+		t.Fatal("Expect success was", w.Body)
+	}
+
+	req, _ = http.NewRequest("POST", "/api/series", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Fatal("Expect", http.StatusUnauthorized, "was", w.Code)
+	}
+}
@@ -3,6 +3,7 @@ package sj
 import (
 	"errors"
 	"sort"
+	"time"
 
 	"github.com/rrawrriw/angular-sauth-handler"
 
@@ -14,6 +15,13 @@ const (
 	SeriesColl  = "Series"
 	UserColl    = "Users"
 	EpisodeColl = "Episodes"
+	SessionColl = "Sessions"
+
+	WatchRecordColl = "WatchRecords"
+	JournalColl     = "Journal"
+	APITokenColl    = "APITokens"
+	TOTPColl        = "TOTP"
+	ShareColl       = "Shares"
 )
 
 type (
@@ -22,31 +30,37 @@ type (
 		URL  string `bson:"URL"`
 	}
 
+	Resources []Resource
+
 	Series struct {
 		ID       bson.ObjectId `bson:"_id,omitempty"`
 		Title    string        `bson:"Title"`
-		Image    Resource      `bson:"Image"`
-		Episodes Resource      `bson:"Episodes"`
-		Desc     Resource      `bson:"Desc"`
-		Portal   Resource      `bson:"Portal"`
-	}
-
-	// In der Zukunft ist es  möglich das man zum Beispiel
-	// für das Feld Portal mehrer Resources hinterlegt kann.
-	// Dann gibt es eine undefinierte Situationen beim
-	// updaten soll nun ein Eintrag an ein Array angehängt
-	// werden oder nicht. Daher dachte ich mir gibt es in
-	// Zukunft ein Append Type. Je nachdem ob ein Feld ein
-	// Append Type ist oder nicht kann das update wie gewünscht
-	// durchgeführt werden.
+		Image    Resources     `bson:"Image"`
+		Episodes Resources     `bson:"Episodes"`
+		Desc     Resources     `bson:"Desc"`
+		Portal   Resources     `bson:"Portal"`
+		// Order of the episodes, empty for the SeasonOrder
+		Order string `bson:"Order"`
+		// The user who created the series, only he may change it
+		Owner bson.ObjectId `bson:"Owner,omitempty"`
+	}
+
+	// Jedes Resource Feld ist entweder nil (keine Änderung),
+	// Resources (ersetzt die Liste), AppendResources (hängt an)
+	// oder RemoveResources (entfernt alle gleichen Einträge),
+	// analog zu ChangeUser.Series.
 	ChangeSeries struct {
 		Title    string
-		Image    Resource
-		Episodes Resource
-		Desc     Resource
-		Portal   Resource
+		Image    interface{}
+		Episodes interface{}
+		Desc     interface{}
+		Portal   interface{}
+		Order    string
 	}
 
+	AppendResources []Resource
+	RemoveResources []Resource
+
 	SeriesList []Series
 
 	User struct {
@@ -55,31 +69,69 @@ type (
 		// die mgo Funktionen nicht mehr funktionieren
 		// diese benötigen eine Öffentliche API sprich
 		// Großbuchstaben
-		Id     bson.ObjectId   `bson:"_id,omitempty"`
-		Name   string          `bson:"Name"`
+		Id   bson.ObjectId `bson:"_id,omitempty"`
+		Name string        `bson:"Name"`
+		// The stores save a hash, see AppContext.Passwords
 		Pass   string          `bson:"Password"`
 		Series []bson.ObjectId `bson:"Series"`
+		// Empty for users from before the roles, see HasRole
+		Role     string `bson:"Role"`
+		Disabled bool   `bson:"Disabled"`
 	}
 
 	ChangeUser struct {
-		Name   string
+		Name string
+		// A hash like User.Pass
 		Pass   string
 		Series interface{}
+		Role   string
+		// nil keeps the current state
+		Disabled *bool
 	}
 
 	Episode struct {
 		ID       bson.ObjectId `bson:"_id,omitempty"`
 		SeriesID bson.ObjectId `bson:"SeriesID"`
 		Title    string        `bson:"Title"`
-		Session  int           `bson:"Session"`
-		Episode  int           `bson:"Episode"`
-		Watched  bool          `bson:"Watched"`
+		// Season 0 holds the specials
+		Session int `bson:"Session"`
+		Episode int `bson:"Episode"`
+		// Part of a multi-part episode starting with 1, 0 for a single
+		// episode
+		Part int `bson:"Part"`
+		// Number counted over all seasons, 0 if unknown
+		Absolute int `bson:"Absolute"`
+		// Air date, zero if unknown
+		Aired time.Time `bson:"Aired"`
 	}
 
 	Episodes []Episode
 
+	// WatchRecord stores that a user has watched an episode, episodes
+	// are shared between users so this cannot be a flag of the Episode.
+	WatchRecord struct {
+		ID        bson.ObjectId `bson:"_id,omitempty"`
+		UserID    bson.ObjectId `bson:"UserID"`
+		SeriesID  bson.ObjectId `bson:"SeriesID"`
+		EpisodeID bson.ObjectId `bson:"EpisodeID"`
+		Watched   time.Time     `bson:"Watched"`
+	}
+
+	// EpisodeState is an episode with the time the user watched it, zero
+	// if he has not watched it.
+	EpisodeState struct {
+		Episode `bson:",inline"`
+		Watched time.Time `bson:"Watched"`
+	}
+
 	AppendIDItems []bson.ObjectId
 	RemoveIDItems []bson.ObjectId
+
+	sessionDoc struct {
+		Token   string    `bson:"Token"`
+		UserID  string    `bson:"UserID"`
+		Expires time.Time `bson:"Expires"`
+	}
 )
 
 // Define Sort List
@@ -99,22 +151,10 @@ func (l Episodes) Len() int {
 	return len(l)
 }
 
+// Episodes are sorted in the SeasonOrder, see SortEpisodes for the other
+// orders.
 func (l Episodes) Less(x, y int) bool {
-	if l[x].Session < l[y].Session {
-		return true
-	}
-
-	if l[x].Session == l[y].Session {
-		if l[x].Episode < l[y].Session {
-			return true
-		} else if l[x].Episode > l[y].Session {
-			return false
-		} else {
-			return true
-		}
-	}
-
-	return false
+	return CompareSeason(l[x], l[y]) < 0
 }
 
 func (l Episodes) Swap(x, y int) {
@@ -133,7 +173,11 @@ func (u User) Password() string {
 func NewSeries(db *mgo.Database, series Series) (bson.ObjectId, error) {
 	coll := db.C(SeriesColl)
 
-	id := bson.NewObjectId()
+	id := series.ID
+	if id == "" {
+		id = bson.NewObjectId()
+	}
+	series = NormalizeSeries(series)
 	series.ID = id
 	err := coll.Insert(series)
 	if err != nil {
@@ -182,33 +226,125 @@ func ResourceEmpty(r Resource) bool {
 	return false
 }
 
+func ContainsResource(l []Resource, r Resource) bool {
+	for _, e := range l {
+		if e == r {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ApplyResourceChange returns the list after a ChangeSeries field change
+// was applied to it, like the MongoDB update in UpdateSeries does.
+func ApplyResourceChange(l Resources, change interface{}) Resources {
+	switch items := change.(type) {
+	case AppendResources:
+		result := append(Resources{}, l...)
+		return append(result, items...)
+	case RemoveResources:
+		result := Resources{}
+		for _, e := range l {
+			if !ContainsResource(items, e) {
+				result = append(result, e)
+			}
+		}
+		return result
+	case Resources:
+		return append(Resources{}, items...)
+	}
+
+	return l
+}
+
+// Resource lists are never nil, so the documents always contain arrays
+// and MongoDB can $push to them.
+func NormalizeSeries(s Series) Series {
+	if s.Image == nil {
+		s.Image = Resources{}
+	}
+
+	if s.Episodes == nil {
+		s.Episodes = Resources{}
+	}
+
+	if s.Desc == nil {
+		s.Desc = Resources{}
+	}
+
+	if s.Portal == nil {
+		s.Portal = Resources{}
+	}
+
+	return s
+}
+
+func (series Series) ResourceFields() map[string]Resources {
+	return map[string]Resources{
+		"Image":    series.Image,
+		"Episodes": series.Episodes,
+		"Desc":     series.Desc,
+		"Portal":   series.Portal,
+	}
+}
+
+func (change ChangeSeries) Fields() map[string]interface{} {
+	return map[string]interface{}{
+		"Image":    change.Image,
+		"Episodes": change.Episodes,
+		"Desc":     change.Desc,
+		"Portal":   change.Portal,
+	}
+}
+
 func UpdateSeries(db *mgo.Database, id bson.ObjectId, change ChangeSeries) error {
 	coll := db.C(SeriesColl)
 
+	update := bson.M{}
 	set := bson.M{}
+	push := bson.M{}
+	pull := bson.M{}
 
 	if change.Title != "" {
 		set["Title"] = change.Title
 	}
 
-	if !ResourceEmpty(change.Image) {
-		set["Image"] = change.Image
+	if change.Order != "" {
+		set["Order"] = change.Order
 	}
 
-	if !ResourceEmpty(change.Desc) {
-		set["Desc"] = change.Desc
+	for field, v := range change.Fields() {
+		switch items := v.(type) {
+		case AppendResources:
+			push[field] = bson.M{
+				"$each": []Resource(items),
+			}
+		case RemoveResources:
+			pull[field] = bson.M{
+				"$in": []Resource(items),
+			}
+		case Resources:
+			set[field] = items
+		}
 	}
 
-	if !ResourceEmpty(change.Episodes) {
-		set["Episodes"] = change.Episodes
+	if len(set) > 0 {
+		update["$set"] = set
 	}
 
-	if !ResourceEmpty(change.Portal) {
-		set["Portal"] = change.Portal
+	if len(push) > 0 {
+		update["$push"] = push
 	}
 
-	update := bson.M{
-		"$set": set,
+	if len(pull) > 0 {
+		update["$pull"] = pull
+	}
+
+	// An empty update would replace the whole document
+	if len(update) == 0 {
+		_, err := ReadSeries(db, id)
+		return err
 	}
 
 	mgoChange := mgo.Change{
@@ -228,10 +364,43 @@ func UpdateSeries(db *mgo.Database, id bson.ObjectId, change ChangeSeries) error
 	return nil
 }
 
+// Removes the series with its episodes and the watch records of all users
+// and drops it from the series list of every user.
 func RemoveSeries(db *mgo.Database, id bson.ObjectId) error {
-	coll := db.C(SeriesColl)
+	selector := bson.M{
+		"Series": id,
+	}
+	update := bson.M{
+		"$pull": bson.M{
+			"Series": id,
+		},
+	}
+	_, err := db.C(UserColl).UpdateAll(selector, update)
+	if err != nil {
+		return err
+	}
 
-	err := coll.RemoveId(id)
+	return removeSeriesData(db, id)
+}
+
+func removeSeriesData(db *mgo.Database, id bson.ObjectId) error {
+	selector := bson.M{
+		"SeriesID": id,
+	}
+
+	_, err := db.C(EpisodeColl).RemoveAll(selector)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.C(WatchRecordColl).RemoveAll(selector)
+	if err != nil {
+		return err
+	}
+
+	// The series goes last, a failed removal can be repeated as long
+	// as the series exists.
+	err = db.C(SeriesColl).RemoveId(id)
 	if err != nil {
 		return err
 	}
@@ -239,20 +408,65 @@ func RemoveSeries(db *mgo.Database, id bson.ObjectId) error {
 	return nil
 }
 
+// Removes the series from the series list of the user together with his
+// watch records. The series itself is removed as soon as no other user
+// references it anymore. Running it again completes an interrupted run.
+func RemoveSeriesOfUser(db *mgo.Database, userID, seriesID bson.ObjectId) error {
+	users := db.C(UserColl)
+
+	update := bson.M{
+		"$pull": bson.M{
+			"Series": seriesID,
+		},
+	}
+	err := users.UpdateId(userID, update)
+	if err != nil {
+		return err
+	}
+
+	selector := bson.M{
+		"UserID":   userID,
+		"SeriesID": seriesID,
+	}
+	_, err = db.C(WatchRecordColl).RemoveAll(selector)
+	if err != nil {
+		return err
+	}
+
+	n, err := users.Find(bson.M{"Series": seriesID}).Count()
+	if err != nil {
+		return err
+	}
+
+	if n > 0 {
+		return nil
+	}
+
+	// Already removed by an earlier run
+	err = removeSeriesData(db, seriesID)
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+
+	return err
+}
+
 func NewUser(db *mgo.Database, user User) (bson.ObjectId, error) {
 	coll := db.C(UserColl)
 
 	id := bson.NewObjectId()
 	newUser := User{
-		Id:     id,
-		Name:   user.Name,
-		Pass:   aauth.NewSha512Password(user.Pass),
-		Series: user.Series,
+		Id:       id,
+		Name:     user.Name,
+		Pass:     user.Pass,
+		Series:   user.Series,
+		Role:     user.Role,
+		Disabled: user.Disabled,
 	}
 
 	err := coll.Insert(newUser)
 	if err != nil {
-		return bson.ObjectId(""), nil
+		return bson.ObjectId(""), err
 	}
 
 	return id, nil
@@ -271,6 +485,18 @@ func ReadUser(db *mgo.Database, id bson.ObjectId) (User, error) {
 	return user, nil
 }
 
+func ReadUsers(db *mgo.Database) ([]User, error) {
+	coll := db.C(UserColl)
+
+	users := []User{}
+	err := coll.Find(nil).Sort("Name").All(&users)
+	if err != nil {
+		return []User{}, err
+	}
+
+	return users, nil
+}
+
 func FindUser(db *mgo.Database, name string) (User, error) {
 	coll := db.C(UserColl)
 
@@ -315,8 +541,15 @@ func UpdateUser(db *mgo.Database, id bson.ObjectId, change ChangeUser) error {
 	}
 
 	if change.Pass != "" {
-		passHash := aauth.NewSha512Password(change.Pass)
-		set["Password"] = passHash
+		set["Password"] = change.Pass
+	}
+
+	if change.Role != "" {
+		set["Role"] = change.Role
+	}
+
+	if change.Disabled != nil {
+		set["Disabled"] = *change.Disabled
 	}
 
 	switch change.Series.(type) {
@@ -433,41 +666,85 @@ func ReadEpisodes(db *mgo.Database, id bson.ObjectId) ([]Episode, error) {
 	return result, nil
 }
 
-func WatchEpisode(db *mgo.Database, id bson.ObjectId) error {
-	coll := db.C(EpisodeColl)
+// WatchEpisode marks the episode as watched for the given user only.
+// Watching an episode again updates the time of the record.
+func WatchEpisode(db *mgo.Database, userID, id bson.ObjectId) error {
+	episode, err := ReadEpisode(db, id)
+	if err != nil {
+		return err
+	}
+
+	coll := db.C(WatchRecordColl)
 
+	selector := bson.M{
+		"UserID":    userID,
+		"EpisodeID": id,
+	}
 	update := bson.M{
 		"$set": bson.M{
-			"Watched": true,
+			"SeriesID": episode.SeriesID,
+			"Watched":  time.Now(),
 		},
 	}
-	mgoChange := mgo.Change{
-		Update:    update,
-		ReturnNew: false,
+	_, err = coll.Upsert(selector, update)
+	if err != nil {
+		return err
 	}
 
-	changeInfo, err := coll.FindId(id).Apply(mgoChange, nil)
+	return nil
+}
+
+func UnwatchEpisode(db *mgo.Database, userID, id bson.ObjectId) error {
+	coll := db.C(WatchRecordColl)
+
+	selector := bson.M{
+		"UserID":    userID,
+		"EpisodeID": id,
+	}
+	err := coll.Remove(selector)
 	if err != nil {
 		return err
 	}
 
-	if changeInfo.Updated != 1 {
-		return errors.New("update error")
+	return nil
+}
+
+func ReadWatchRecords(db *mgo.Database, userID, seriesID bson.ObjectId) ([]WatchRecord, error) {
+	coll := db.C(WatchRecordColl)
+
+	result := []WatchRecord{}
+	query := bson.M{
+		"UserID":   userID,
+		"SeriesID": seriesID,
+	}
+	err := coll.Find(query).All(&result)
+	if err != nil {
+		return []WatchRecord{}, err
 	}
 
-	return nil
+	return result, nil
 }
 
-func ReadWatchedEpisodes(db *mgo.Database, id bson.ObjectId) (Episodes, error) {
+func ReadWatchedEpisodes(db *mgo.Database, userID, seriesID bson.ObjectId) (Episodes, error) {
+	records, err := ReadWatchRecords(db, userID, seriesID)
+	if err != nil {
+		return Episodes{}, err
+	}
+
+	ids := []bson.ObjectId{}
+	for _, r := range records {
+		ids = append(ids, r.EpisodeID)
+	}
+
 	coll := db.C(EpisodeColl)
 
 	result := Episodes{}
 	query := bson.M{
-		"SeriesID": id,
-		"Watched":  true,
+		"_id": bson.M{
+			"$in": ids,
+		},
 	}
-	find := coll.Find(query)
-	err := find.All(&result)
+	err = coll.Find(query).All(&result)
 	if err != nil {
 		return Episodes{}, err
 	}
@@ -476,3 +753,298 @@ func ReadWatchedEpisodes(db *mgo.Database, id bson.ObjectId) (Episodes, error) {
 
 	return result, nil
 }
+
+// ReadEpisodeStates joins the series of the user with their episodes and
+// his watch records in one aggregation.
+func ReadEpisodeStates(db *mgo.Database, userID bson.ObjectId) ([]EpisodeState, error) {
+	coll := db.C(UserColl)
+
+	records := bson.M{
+		"$filter": bson.M{
+			"input": "$Records",
+			"as":    "r",
+			"cond":  bson.M{"$eq": []interface{}{"$$r.UserID", userID}},
+		},
+	}
+	pipeline := []bson.M{
+		{"$match": bson.M{"_id": userID}},
+		{"$lookup": bson.M{
+			"from":         EpisodeColl,
+			"localField":   "Series",
+			"foreignField": "SeriesID",
+			"as":           "Episode",
+		}},
+		{"$unwind": "$Episode"},
+		{"$lookup": bson.M{
+			"from":         WatchRecordColl,
+			"localField":   "Episode._id",
+			"foreignField": "EpisodeID",
+			"as":           "Records",
+		}},
+		{"$project": bson.M{
+			"_id":      "$Episode._id",
+			"SeriesID": "$Episode.SeriesID",
+			"Title":    "$Episode.Title",
+			"Session":  "$Episode.Session",
+			"Episode":  "$Episode.Episode",
+			"Part":     "$Episode.Part",
+			"Absolute": "$Episode.Absolute",
+			"Aired":    "$Episode.Aired",
+			"Watched": bson.M{"$max": bson.M{
+				"$map": bson.M{"input": records, "as": "r", "in": "$$r.Watched"},
+			}},
+		}},
+	}
+
+	result := []EpisodeState{}
+	err := coll.Pipe(pipeline).All(&result)
+	if err != nil {
+		return []EpisodeState{}, err
+	}
+
+	return result, nil
+}
+
+func NewSession(db *mgo.Database, session aauth.Session) error {
+	coll := db.C(SessionColl)
+
+	doc := sessionDoc{
+		Token:   session.Token,
+		UserID:  session.UserID,
+		Expires: session.Expires,
+	}
+
+	return coll.Insert(doc)
+}
+
+func ReadSession(db *mgo.Database, token string) (aauth.Session, error) {
+	coll := db.C(SessionColl)
+
+	doc := sessionDoc{}
+	err := coll.Find(bson.M{"Token": token}).One(&doc)
+	if err != nil {
+		return aauth.Session{}, err
+	}
+
+	session := aauth.Session{
+		Token:   doc.Token,
+		UserID:  doc.UserID,
+		Expires: doc.Expires,
+	}
+
+	return session, nil
+}
+
+func ReadSessionsOfUser(db *mgo.Database, userID string) ([]aauth.Session, error) {
+	coll := db.C(SessionColl)
+
+	docs := []sessionDoc{}
+	err := coll.Find(bson.M{"UserID": userID}).All(&docs)
+	if err != nil {
+		return []aauth.Session{}, err
+	}
+
+	sessions := []aauth.Session{}
+	for _, doc := range docs {
+		session := aauth.Session{
+			Token:   doc.Token,
+			UserID:  doc.UserID,
+			Expires: doc.Expires,
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
+
+func RemoveSession(db *mgo.Database, token string) error {
+	coll := db.C(SessionColl)
+
+	return coll.Remove(bson.M{"Token": token})
+}
+
+func NewAPIToken(db *mgo.Database, token APIToken) (bson.ObjectId, error) {
+	coll := db.C(APITokenColl)
+
+	id := bson.NewObjectId()
+	token.ID = id
+	err := coll.Insert(token)
+	if err != nil {
+		return bson.ObjectId(""), err
+	}
+
+	return id, nil
+}
+
+func ReadAPIToken(db *mgo.Database, hash string) (APIToken, error) {
+	coll := db.C(APITokenColl)
+
+	token := APIToken{}
+	err := coll.Find(bson.M{"Hash": hash}).One(&token)
+	if err != nil {
+		return APIToken{}, err
+	}
+
+	return token, nil
+}
+
+func ReadAPITokensOfUser(db *mgo.Database, userID bson.ObjectId) ([]APIToken, error) {
+	coll := db.C(APITokenColl)
+
+	tokens := []APIToken{}
+	err := coll.Find(bson.M{"UserID": userID}).Sort("Created").All(&tokens)
+	if err != nil {
+		return []APIToken{}, err
+	}
+
+	return tokens, nil
+}
+
+func RemoveAPIToken(db *mgo.Database, id bson.ObjectId) error {
+	coll := db.C(APITokenColl)
+
+	return coll.RemoveId(id)
+}
+
+func NewShare(db *mgo.Database, share Share) (bson.ObjectId, error) {
+	coll := db.C(ShareColl)
+
+	id := bson.NewObjectId()
+	share.ID = id
+	err := coll.Insert(share)
+	if err != nil {
+		return bson.ObjectId(""), err
+	}
+
+	return id, nil
+}
+
+func ReadShare(db *mgo.Database, ownerID, userID bson.ObjectId) (Share, error) {
+	coll := db.C(ShareColl)
+
+	share := Share{}
+	query := bson.M{"OwnerID": ownerID, "UserID": userID}
+	err := coll.Find(query).One(&share)
+	if err != nil {
+		return Share{}, err
+	}
+
+	return share, nil
+}
+
+func ReadShares(db *mgo.Database, query bson.M) ([]Share, error) {
+	coll := db.C(ShareColl)
+
+	shares := []Share{}
+	err := coll.Find(query).Sort("Created").All(&shares)
+	if err != nil {
+		return []Share{}, err
+	}
+
+	return shares, nil
+}
+
+func RemoveShare(db *mgo.Database, id bson.ObjectId) error {
+	coll := db.C(ShareColl)
+
+	return coll.RemoveId(id)
+}
+
+func ReadTOTP(db *mgo.Database, userID bson.ObjectId) (TOTP, error) {
+	coll := db.C(TOTPColl)
+
+	totp := TOTP{}
+	err := coll.FindId(userID).One(&totp)
+	if err != nil {
+		return TOTP{}, err
+	}
+
+	return totp, nil
+}
+
+// The user ID is the _id of the document, every user has one TOTP at most
+func SaveTOTP(db *mgo.Database, totp TOTP) error {
+	coll := db.C(TOTPColl)
+
+	_, err := coll.UpsertId(totp.UserID, totp)
+	return err
+}
+
+func RemoveTOTP(db *mgo.Database, userID bson.ObjectId) error {
+	coll := db.C(TOTPColl)
+
+	return coll.RemoveId(userID)
+}
+
+// The conditions of the updates make concurrent logins with the same code
+// fail, only one of them finds the document.
+func UseTOTPStep(db *mgo.Database, userID bson.ObjectId, step int64) error {
+	coll := db.C(TOTPColl)
+
+	selector := bson.M{
+		"_id":      userID,
+		"LastStep": bson.M{"$lt": step},
+	}
+	update := bson.M{
+		"$set": bson.M{"LastStep": step, "Failures": 0},
+	}
+
+	return coll.Update(selector, update)
+}
+
+func UseRecoveryCode(db *mgo.Database, userID bson.ObjectId, hash string) error {
+	coll := db.C(TOTPColl)
+
+	selector := bson.M{
+		"_id":           userID,
+		"RecoveryCodes": hash,
+	}
+	update := bson.M{
+		"$pull": bson.M{"RecoveryCodes": hash},
+		"$set":  bson.M{"Failures": 0},
+	}
+
+	return coll.Update(selector, update)
+}
+
+func FailTOTP(db *mgo.Database, userID bson.ObjectId, now time.Time) error {
+	coll := db.C(TOTPColl)
+
+	update := bson.M{
+		"$inc": bson.M{"Failures": 1},
+		"$set": bson.M{"LastFailure": now},
+	}
+
+	return coll.UpdateId(userID, update)
+}
+
+func NewJournalEntry(db *mgo.Database, entry JournalEntry) (bson.ObjectId, error) {
+	coll := db.C(JournalColl)
+
+	id := bson.NewObjectId()
+	entry.ID = id
+	err := coll.Insert(entry)
+	if err != nil {
+		return bson.ObjectId(""), err
+	}
+
+	return id, nil
+}
+
+func ReadJournal(db *mgo.Database) ([]JournalEntry, error) {
+	coll := db.C(JournalColl)
+
+	entries := []JournalEntry{}
+	err := coll.Find(nil).Sort("Created").All(&entries)
+	if err != nil {
+		return []JournalEntry{}, err
+	}
+
+	return entries, nil
+}
+
+func RemoveJournalEntry(db *mgo.Database, id bson.ObjectId) error {
+	coll := db.C(JournalColl)
+
+	return coll.RemoveId(id)
+}
@@ -3,9 +3,6 @@ package sj
 import (
 	"testing"
 
-	"github.com/rrawrriw/angular-sauth-handler"
-
-	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
 
@@ -17,12 +14,25 @@ func EqualResource(r1 Resource, r2 Resource) bool {
 	return false
 }
 
+func EqualResources(l1 []Resource, l2 []Resource) bool {
+	if len(l1) != len(l2) {
+		return false
+	}
+
+	for i, r := range l1 {
+		if !EqualResource(r, l2[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
 func EqualEpisode(e1 Episode, e2 Episode) bool {
 	if e1.Episode == e2.Episode &&
 		e1.SeriesID == e2.SeriesID &&
 		e1.Session == e2.Session &&
-		e1.Title == e2.Title &&
-		e1.Watched == e1.Watched {
+		e1.Title == e2.Title {
 		return true
 	}
 
@@ -31,10 +41,10 @@ func EqualEpisode(e1 Episode, e2 Episode) bool {
 
 func EqualSeries(s1 Series, s2 Series) bool {
 	if s1.Title == s2.Title &&
-		EqualResource(s1.Image, s2.Image) &&
-		EqualResource(s1.Episodes, s2.Episodes) &&
-		EqualResource(s1.Desc, s2.Desc) &&
-		EqualResource(s1.Portal, s2.Portal) {
+		EqualResources(s1.Image, s2.Image) &&
+		EqualResources(s1.Episodes, s2.Episodes) &&
+		EqualResources(s1.Desc, s2.Desc) &&
+		EqualResources(s1.Portal, s2.Portal) {
 		return true
 	}
 
@@ -53,7 +63,7 @@ func ExistsID(ids []bson.ObjectId, id bson.ObjectId) bool {
 
 // Expect user and retuned user
 func EqualUser(u1 User, u2 User) bool {
-	if u1.Name == u2.Name && aauth.NewSha512Password(u1.Pass) == u2.Pass {
+	if u1.Name == u2.Name && u1.Pass == u2.Pass {
 		for _, s := range u1.Series {
 			if !ExistsID(u2.Series, s) {
 				return false
@@ -67,35 +77,35 @@ func EqualUser(u1 User, u2 User) bool {
 }
 
 func Test_CRUDFuncSeries_OK(t *testing.T) {
-	session, db := DialTestDB(t)
-	defer CleanTestDB(session, db, t)
+	store := NewTestStore(t)
+	defer CleanTestStore(store, t)
 
 	series := Series{
 		Title: "Mr. Robot",
-		Image: Resource{
+		Image: Resources{{
 			"imdb.com",
 			"http://www.imdb.com/title/tt4158110/",
-		},
-		Episodes: Resource{
+		}},
+		Episodes: Resources{{
 			"serienjunkie.de",
 			"http://www.serienjunkies.de/mr-robot/",
-		},
-		Desc: Resource{
+		}},
+		Desc: Resources{{
 			"serienjunkie.de",
 			"http://www.serienjunkies.de/mr-robot/",
-		},
-		Portal: Resource{
+		}},
+		Portal: Resources{{
 			"kinox.to",
 			"http://kinox.to/Stream/Mr-Robot.html",
-		},
+		}},
 	}
 
-	id, err := NewSeries(db, series)
+	id, err := store.NewSeries(series)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	result, err := ReadSeries(db, id)
+	result, err := store.ReadSeries(id)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -106,50 +116,50 @@ func Test_CRUDFuncSeries_OK(t *testing.T) {
 
 	change := ChangeSeries{
 		Title: "Narcos",
-		Image: Resource{
+		Image: Resources{{
 			"kinox.to",
 			"http://kinox.to/Stream/Narcos.html",
-		},
-		Episodes: Resource{
+		}},
+		Episodes: Resources{{
 			"imdb.com",
 			"http://www.imdb.com/title/tt2707408",
-		},
-		Desc: Resource{
+		}},
+		Desc: Resources{{
 			"imdb.com",
 			"http://www.imdb.com/title/tt2707408",
-		},
-		Portal: Resource{
+		}},
+		Portal: Resources{{
 			"kinox.to",
 			"http://kinox.to/Stream/Narcos.html",
-		},
+		}},
 	}
 
 	updatedSeries := Series{
 		Title: "Narcos",
-		Image: Resource{
+		Image: Resources{{
 			"kinox.to",
 			"http://kinox.to/Stream/Narcos.html",
-		},
-		Episodes: Resource{
+		}},
+		Episodes: Resources{{
 			"imdb.com",
 			"http://www.imdb.com/title/tt2707408",
-		},
-		Desc: Resource{
+		}},
+		Desc: Resources{{
 			"imdb.com",
 			"http://www.imdb.com/title/tt2707408",
-		},
-		Portal: Resource{
+		}},
+		Portal: Resources{{
 			"kinox.to",
 			"http://kinox.to/Stream/Narcos.html",
-		},
+		}},
 	}
 
-	err = UpdateSeries(db, id, change)
+	err = store.UpdateSeries(id, change)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	result, err = ReadSeries(db, id)
+	result, err = store.ReadSeries(id)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -164,30 +174,30 @@ func Test_CRUDFuncSeries_OK(t *testing.T) {
 
 	updatedSeries = Series{
 		Title: "True Detective",
-		Image: Resource{
+		Image: Resources{{
 			"kinox.to",
 			"http://kinox.to/Stream/Narcos.html",
-		},
-		Episodes: Resource{
+		}},
+		Episodes: Resources{{
 			"imdb.com",
 			"http://www.imdb.com/title/tt2707408",
-		},
-		Desc: Resource{
+		}},
+		Desc: Resources{{
 			"imdb.com",
 			"http://www.imdb.com/title/tt2707408",
-		},
-		Portal: Resource{
+		}},
+		Portal: Resources{{
 			"kinox.to",
 			"http://kinox.to/Stream/Narcos.html",
-		},
+		}},
 	}
 
-	err = UpdateSeries(db, id, change)
+	err = store.UpdateSeries(id, change)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	result, err = ReadSeries(db, id)
+	result, err = store.ReadSeries(id)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -196,68 +206,141 @@ func Test_CRUDFuncSeries_OK(t *testing.T) {
 		t.Fatal("Expect", updatedSeries, "was", result)
 	}
 
-	err = RemoveSeries(db, id)
+	err = store.RemoveSeries(id)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	_, err = ReadSeries(db, id)
-	if err != mgo.ErrNotFound {
+	_, err = store.ReadSeries(id)
+	if err != NotFoundError {
 		t.Fatal(err)
 	}
 
 }
 
+func Test_UpdateSeriesResources_OK(t *testing.T) {
+	store := NewTestStore(t)
+	defer CleanTestStore(store, t)
+
+	kinox := Resource{
+		"kinox.to",
+		"http://kinox.to/Stream/Narcos.html",
+	}
+	netflix := Resource{
+		"netflix.com",
+		"https://www.netflix.com/title/80025172",
+	}
+	imdb := Resource{
+		"imdb.com",
+		"http://www.imdb.com/title/tt2707408",
+	}
+
+	series := Series{
+		Title:  "Narcos",
+		Portal: Resources{kinox},
+		Desc:   Resources{imdb},
+	}
+
+	id, err := store.NewSeries(series)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	change := ChangeSeries{
+		Portal: AppendResources{netflix, kinox},
+		Desc:   Resources{},
+	}
+	err = store.UpdateSeries(id, change)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := Series{
+		Title:  "Narcos",
+		Portal: Resources{kinox, netflix, kinox},
+	}
+
+	result, err := store.ReadSeries(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !EqualSeries(expect, result) {
+		t.Fatal("Expect", expect, "was", result)
+	}
+
+	change = ChangeSeries{
+		Portal: RemoveResources{kinox},
+		Image:  Resources{imdb},
+	}
+	err = store.UpdateSeries(id, change)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect.Portal = Resources{netflix}
+	expect.Image = Resources{imdb}
+
+	result, err = store.ReadSeries(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !EqualSeries(expect, result) {
+		t.Fatal("Expect", expect, "was", result)
+	}
+}
+
 func Test_ReadAllSeries_OK(t *testing.T) {
-	session, db := DialTestDB(t)
-	defer CleanTestDB(session, db, t)
+	store := NewTestStore(t)
+	defer CleanTestStore(store, t)
 
 	series1 := Series{
 		Title: "Narcos",
-		Image: Resource{
+		Image: Resources{{
 			"kinox.to",
 			"http://kinox.to/Stream/Narcos.html",
-		},
-		Episodes: Resource{
+		}},
+		Episodes: Resources{{
 			"imdb.com",
 			"http://www.imdb.com/title/tt2707408",
-		},
-		Desc: Resource{
+		}},
+		Desc: Resources{{
 			"imdb.com",
 			"http://www.imdb.com/title/tt2707408",
-		},
-		Portal: Resource{
+		}},
+		Portal: Resources{{
 			"kinox.to",
 			"http://kinox.to/Stream/Narcos.html",
-		},
+		}},
 	}
 
-	id1, err := NewSeries(db, series1)
+	id1, err := store.NewSeries(series1)
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	series2 := Series{
 		Title: "Mr. Robot",
-		Image: Resource{
+		Image: Resources{{
 			"imdb.com",
 			"http://www.imdb.com/title/tt4158110/",
-		},
-		Episodes: Resource{
+		}},
+		Episodes: Resources{{
 			"serienjunkie.de",
 			"http://www.serienjunkies.de/mr-robot/",
-		},
-		Desc: Resource{
+		}},
+		Desc: Resources{{
 			"serienjunkie.de",
 			"http://www.serienjunkies.de/mr-robot/",
-		},
-		Portal: Resource{
+		}},
+		Portal: Resources{{
 			"kinox.to",
 			"http://kinox.to/Stream/Mr-Robot.html",
-		},
+		}},
 	}
 
-	id2, err := NewSeries(db, series2)
+	id2, err := store.NewSeries(series2)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -267,7 +350,7 @@ func Test_ReadAllSeries_OK(t *testing.T) {
 		id2,
 	}
 
-	sList, err := ReadAllSeries(db, ids)
+	sList, err := store.ReadAllSeries(ids)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -288,12 +371,12 @@ func Test_ReadAllSeries_OK(t *testing.T) {
 		},
 	}
 
-	uID, err := NewUser(db, user)
+	uID, err := store.NewUser(user)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	sList, err = ReadSeriesOfUser(db, uID)
+	sList, err = store.ReadSeriesOfUser(uID)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -308,31 +391,145 @@ func Test_ReadAllSeries_OK(t *testing.T) {
 
 }
 
+func Test_RemoveSeriesOfUser_OK(t *testing.T) {
+	store := NewTestStore(t)
+	defer CleanTestStore(store, t)
+
+	seriesID, err := store.NewSeries(Series{Title: "Narcos"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user1 := User{
+		Name:   "greatLover99",
+		Series: []bson.ObjectId{seriesID},
+	}
+	user1ID, err := store.NewUser(user1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user2 := User{
+		Name:   "otherLover",
+		Series: []bson.ObjectId{seriesID},
+	}
+	user2ID, err := store.NewUser(user2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	episode := Episode{
+		SeriesID: seriesID,
+		Title:    "Descenso",
+		Session:  1,
+		Episode:  1,
+	}
+	episodeID, err := store.NewEpisode(episode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []bson.ObjectId{user1ID, user2ID} {
+		err := store.WatchEpisode(id, episodeID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = store.RemoveSeriesOfUser(user1ID, seriesID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The other user still follows the series
+	_, err = store.ReadSeries(seriesID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	watched, err := store.ReadWatchedEpisodes(user1ID, seriesID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(watched) != 0 {
+		t.Fatal("Expect no watched episodes was", watched)
+	}
+
+	watched, err = store.ReadWatchedEpisodes(user2ID, seriesID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(watched) != 1 {
+		t.Fatal("Expect", episodeID, "was", watched)
+	}
+
+	// Running it again changes nothing
+	err = store.RemoveSeriesOfUser(user1ID, seriesID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.ReadSeries(seriesID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.RemoveSeriesOfUser(user2ID, seriesID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.ReadSeries(seriesID)
+	if err != NotFoundError {
+		t.Fatal("Expect", NotFoundError, "was", err)
+	}
+
+	episodes, err := store.ReadEpisodes(seriesID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(episodes) != 0 {
+		t.Fatal("Expect no episodes was", episodes)
+	}
+
+	user, err := store.ReadUser(user2ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(user.Series) != 0 {
+		t.Fatal("Expect no series was", user.Series)
+	}
+}
+
 func Test_CRUDFuncUser_OK(t *testing.T) {
-	session, db := DialTestDB(t)
-	defer CleanTestDB(session, db, t)
+	store := NewTestStore(t)
+	defer CleanTestStore(store, t)
 
 	series1 := Series{
 		Title: "Narcos",
-		Image: Resource{
+		Image: Resources{{
 			"kinox.to",
 			"http://kinox.to/Stream/Narcos.html",
-		},
-		Episodes: Resource{
+		}},
+		Episodes: Resources{{
 			"imdb.com",
 			"http://www.imdb.com/title/tt2707408",
-		},
-		Desc: Resource{
+		}},
+		Desc: Resources{{
 			"imdb.com",
 			"http://www.imdb.com/title/tt2707408",
-		},
-		Portal: Resource{
+		}},
+		Portal: Resources{{
 			"kinox.to",
 			"http://kinox.to/Stream/Narcos.html",
-		},
+		}},
 	}
 
-	sID1, err := NewSeries(db, series1)
+	sID1, err := store.NewSeries(series1)
 
 	user := User{
 		Name: "Nase",
@@ -342,12 +539,12 @@ func Test_CRUDFuncUser_OK(t *testing.T) {
 		},
 	}
 
-	uID, err := NewUser(db, user)
+	uID, err := store.NewUser(user)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	result, err := ReadUser(db, uID)
+	result, err := store.ReadUser(uID)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -356,7 +553,7 @@ func Test_CRUDFuncUser_OK(t *testing.T) {
 		t.Fatal("Expect", user, "was", result)
 	}
 
-	result, err = FindUser(db, user.Name)
+	result, err = store.FindUser(user.Name)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -367,25 +564,25 @@ func Test_CRUDFuncUser_OK(t *testing.T) {
 
 	series2 := Series{
 		Title: "Mr. Robot",
-		Image: Resource{
+		Image: Resources{{
 			"imdb.com",
 			"http://www.imdb.com/title/tt4158110/",
-		},
-		Episodes: Resource{
+		}},
+		Episodes: Resources{{
 			"serienjunkie.de",
 			"http://www.serienjunkies.de/mr-robot/",
-		},
-		Desc: Resource{
+		}},
+		Desc: Resources{{
 			"serienjunkie.de",
 			"http://www.serienjunkies.de/mr-robot/",
-		},
-		Portal: Resource{
+		}},
+		Portal: Resources{{
 			"kinox.to",
 			"http://kinox.to/Stream/Mr-Robot.html",
-		},
+		}},
 	}
 
-	sID2, err := NewSeries(db, series2)
+	sID2, err := store.NewSeries(series2)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -398,7 +595,7 @@ func Test_CRUDFuncUser_OK(t *testing.T) {
 		},
 	}
 
-	err = UpdateUser(db, uID, change)
+	err = store.UpdateUser(uID, change)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -412,7 +609,7 @@ func Test_CRUDFuncUser_OK(t *testing.T) {
 		},
 	}
 
-	result, err = ReadUser(db, uID)
+	result, err = store.ReadUser(uID)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -427,7 +624,7 @@ func Test_CRUDFuncUser_OK(t *testing.T) {
 		},
 	}
 
-	err = UpdateUser(db, uID, change)
+	err = store.UpdateUser(uID, change)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -444,38 +641,39 @@ func Test_CRUDFuncUser_OK(t *testing.T) {
 		t.Fatal("Expect", updatedUser, "was", result)
 	}
 
-	err = RemoveUser(db, uID)
+	err = store.RemoveUser(uID)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	_, err = ReadUser(db, uID)
-	if err != mgo.ErrNotFound {
+	_, err = store.ReadUser(uID)
+	if err != NotFoundError {
 		t.Fatal(err)
 	}
 
 }
 
 func Test_CRUDFuncEpisode_OK(t *testing.T) {
-	session, db := DialTestDB(t)
-	defer CleanTestDB(session, db, t)
+	store := NewTestStore(t)
+	defer CleanTestStore(store, t)
 
 	seriesID := bson.NewObjectId()
+	userID := bson.NewObjectId()
+	otherUserID := bson.NewObjectId()
 
 	episode := Episode{
 		SeriesID: seriesID,
 		Session:  1,
 		Episode:  1,
 		Title:    "Title",
-		Watched:  false,
 	}
 
-	id, err := NewEpisode(db, episode)
+	id, err := store.NewEpisode(episode)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	result, err := ReadEpisode(db, id)
+	result, err := store.ReadEpisode(id)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -484,37 +682,30 @@ func Test_CRUDFuncEpisode_OK(t *testing.T) {
 		t.Fatal("Expect", episode, "was", result)
 	}
 
-	err = WatchEpisode(db, id)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	updatedEpisode := Episode{
+	episode2 := Episode{
 		SeriesID: seriesID,
 		Session:  1,
-		Episode:  1,
-		Title:    "Title",
-		Watched:  true,
+		Episode:  2,
+		Title:    "Title 2",
 	}
 
-	result, err = ReadEpisode(db, id)
+	id2, err := store.NewEpisode(episode2)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	if !EqualEpisode(updatedEpisode, result) {
-		t.Fatal("Expect", episode, "was", result)
+	err = store.WatchEpisode(userID, id2)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	episode2 := Episode{
-		SeriesID: seriesID,
-		Session:  1,
-		Episode:  2,
-		Title:    "Title 2",
-		Watched:  true,
+	err = store.WatchEpisode(userID, id)
+	if err != nil {
+		t.Fatal(err)
 	}
 
-	_, err = NewEpisode(db, episode2)
+	// Watching twice must not create a second record
+	err = store.WatchEpisode(userID, id)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -524,22 +715,55 @@ func Test_CRUDFuncEpisode_OK(t *testing.T) {
 		episode2,
 	}
 
-	allWatchedEpisodes, err := ReadWatchedEpisodes(db, seriesID)
+	allWatchedEpisodes, err := store.ReadWatchedEpisodes(userID, seriesID)
 	if err != nil {
 		t.Fatal(err)
 	}
 
+	if len(allWatchedEpisodes) != len(watchedEpisodes) {
+		t.Fatal("Expect", watchedEpisodes, "was", allWatchedEpisodes)
+	}
+
 	for i, e := range watchedEpisodes {
 		if !EqualEpisode(e, allWatchedEpisodes[i]) {
 			t.Fatal("Expect", e, "was", allWatchedEpisodes[i])
 		}
 	}
 
+	// The watch state of one user is invisible for the other one
+	otherWatched, err := store.ReadWatchedEpisodes(otherUserID, seriesID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(otherWatched) != 0 {
+		t.Fatal("Expect no watched episodes was", otherWatched)
+	}
+
+	err = store.UnwatchEpisode(userID, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	allWatchedEpisodes, err = store.ReadWatchedEpisodes(userID, seriesID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(allWatchedEpisodes) != 1 || !EqualEpisode(episode2, allWatchedEpisodes[0]) {
+		t.Fatal("Expect", episode2, "was", allWatchedEpisodes)
+	}
+
+	err = store.UnwatchEpisode(otherUserID, id2)
+	if err != NotFoundError {
+		t.Fatal("Expect", NotFoundError, "was", err)
+	}
+
 }
 
 func Test_NewEpisodeBatch_OK(t *testing.T) {
-	session, db := DialTestDB(t)
-	defer CleanTestDB(session, db, t)
+	store := NewTestStore(t)
+	defer CleanTestStore(store, t)
 
 	seriesID := bson.NewObjectId()
 	episode := Episode{
@@ -547,7 +771,6 @@ func Test_NewEpisodeBatch_OK(t *testing.T) {
 		Session:  1,
 		Episode:  1,
 		Title:    "Title",
-		Watched:  false,
 	}
 
 	episode2 := Episode{
@@ -555,19 +778,18 @@ func Test_NewEpisodeBatch_OK(t *testing.T) {
 		Session:  1,
 		Episode:  2,
 		Title:    "Title 2",
-		Watched:  true,
 	}
 
 	episodes := []Episode{
 		episode,
 		episode2,
 	}
-	_, err := NewEpisodeBatch(db, episodes)
+	_, err := store.NewEpisodeBatch(episodes)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	eResult, err := ReadEpisodes(db, seriesID)
+	eResult, err := store.ReadEpisodes(seriesID)
 	if err != nil {
 		t.Fatal(err)
 	}
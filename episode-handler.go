@@ -0,0 +1,300 @@
+package sj
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type (
+	// UserEpisode is an Episode together with the watch state of the
+	// session user.
+	UserEpisode struct {
+		Episode
+		Watched bool
+	}
+
+	// EpisodeBody is the Data of a new episode, nil fields are missing.
+	// Aired is a date like 2006-01-02.
+	EpisodeBody struct {
+		Title    *string
+		Session  *int
+		Episode  *int
+		Part     *int
+		Absolute *int
+		Aired    *string
+	}
+)
+
+func ParseIDParam(c *gin.Context, name string) (bson.ObjectId, error) {
+	param := c.Params.ByName(name)
+	if param == "" {
+		m := fmt.Sprintf("Missing %v parameter", name)
+		return bson.ObjectId(""), NewValidationError(m)
+	}
+
+	if !bson.IsObjectIdHex(param) {
+		m := fmt.Sprintf("Wrong %v parameter", name)
+		return bson.ObjectId(""), NewValidationError(m)
+	}
+
+	return bson.ObjectIdHex(param), nil
+}
+
+func ParseNewEpisodeRequest(r *http.Request) (Episode, error) {
+	body, err := DecodeRequest[EpisodeBody](r)
+	if err != nil {
+		return Episode{}, err
+	}
+
+	v := &Validator{}
+	e := v.Episode(body, "")
+
+	err = v.Err()
+	if err != nil {
+		return Episode{}, err
+	}
+
+	return e, nil
+}
+
+// Reports the problems of all episodes at once, the fields are prefixed
+// with the index like [2].Title.
+func ParseNewEpisodeBatchRequest(r *http.Request) ([]Episode, error) {
+	body, err := DecodeRequest[[]EpisodeBody](r)
+	if err != nil {
+		return []Episode{}, err
+	}
+
+	v := &Validator{}
+	episodes := []Episode{}
+	for i, e := range body {
+		episodes = append(episodes, v.Episode(e, indexPath("", i)))
+	}
+
+	err = v.Err()
+	if err != nil {
+		return []Episode{}, err
+	}
+
+	return episodes, nil
+}
+
+func ReadEpisodesHandler(c *gin.Context, app AppContext) error {
+	seriesID, err := ParseIDParam(c, "id")
+	if err != nil {
+		return err
+	}
+
+	store := app.Store()
+	user, err := ReadSeriesOwner(c, store, seriesID)
+	if err != nil {
+		return err
+	}
+
+	series, err := store.ReadSeries(seriesID)
+	if err != nil {
+		return err
+	}
+
+	episodes, err := store.ReadEpisodes(seriesID)
+	if err != nil {
+		return err
+	}
+	SortEpisodes(episodes, series.Order)
+
+	watched, err := store.ReadWatchedEpisodes(user.Id, seriesID)
+	if err != nil {
+		return err
+	}
+
+	watchedIDs := []bson.ObjectId{}
+	for _, e := range watched {
+		watchedIDs = append(watchedIDs, e.ID)
+	}
+
+	data := []UserEpisode{}
+	for _, e := range episodes {
+		ue := UserEpisode{
+			Episode: e,
+			Watched: ContainsID(watchedIDs, e.ID),
+		}
+		data = append(data, ue)
+	}
+
+	c.JSON(http.StatusOK, NewSuccessResponse(data))
+
+	return nil
+}
+
+func NewEpisodeHandler(c *gin.Context, app AppContext) error {
+	seriesID, err := ParseIDParam(c, "id")
+	if err != nil {
+		return err
+	}
+
+	episode, err := ParseNewEpisodeRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	store := app.Store()
+	_, err = ReadSeriesOwner(c, store, seriesID)
+	if err != nil {
+		return err
+	}
+
+	episode.SeriesID = seriesID
+	id, err := store.NewEpisode(episode)
+	if err != nil {
+		return err
+	}
+
+	data := IDData{
+		ID: id.Hex(),
+	}
+	c.JSON(http.StatusOK, NewSuccessResponse(data))
+
+	return nil
+}
+
+func NewEpisodeBatchHandler(c *gin.Context, app AppContext) error {
+	seriesID, err := ParseIDParam(c, "id")
+	if err != nil {
+		return err
+	}
+
+	episodes, err := ParseNewEpisodeBatchRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	if len(episodes) == 0 {
+		return NewValidationError("Wrong request")
+	}
+
+	store := app.Store()
+	_, err = ReadSeriesOwner(c, store, seriesID)
+	if err != nil {
+		return err
+	}
+
+	for i := range episodes {
+		episodes[i].SeriesID = seriesID
+	}
+
+	ids, err := store.NewEpisodeBatch(episodes)
+	if err != nil {
+		return err
+	}
+
+	data := []IDData{}
+	for _, id := range ids {
+		data = append(data, IDData{ID: id.Hex()})
+	}
+	c.JSON(http.StatusOK, NewSuccessResponse(data))
+
+	return nil
+}
+
+// ReadEpisodeOwner returns the session user if the episode is in one of
+// his series. Missing and foreign episodes fail alike, so the IDs of
+// other users cannot be probed.
+func ReadEpisodeOwner(c *gin.Context, store Store, episodeID bson.ObjectId) (User, error) {
+	user, err := ReadSessionUser(c, store)
+	if err != nil {
+		return User{}, err
+	}
+
+	episode, err := store.ReadEpisode(episodeID)
+	if err != nil && err != NotFoundError {
+		return User{}, err
+	}
+
+	if err == NotFoundError || !ContainsID(user.Series, episode.SeriesID) {
+		m := fmt.Sprintf("Cannot access %v", episodeID.Hex())
+		return User{}, NewForbiddenError(m)
+	}
+
+	return user, nil
+}
+
+func WatchEpisodeHandler(c *gin.Context, app AppContext) error {
+	episodeID, err := ParseIDParam(c, "id")
+	if err != nil {
+		return err
+	}
+
+	store := app.Store()
+	user, err := ReadEpisodeOwner(c, store, episodeID)
+	if err != nil {
+		return err
+	}
+
+	err = store.WatchEpisode(user.Id, episodeID)
+	if err != nil {
+		return err
+	}
+
+	data := IDData{
+		ID: episodeID.Hex(),
+	}
+	c.JSON(http.StatusOK, NewSuccessResponse(data))
+
+	return nil
+}
+
+func UnwatchEpisodeHandler(c *gin.Context, app AppContext) error {
+	episodeID, err := ParseIDParam(c, "id")
+	if err != nil {
+		return err
+	}
+
+	store := app.Store()
+	user, err := ReadEpisodeOwner(c, store, episodeID)
+	if err != nil {
+		return err
+	}
+
+	err = store.UnwatchEpisode(user.Id, episodeID)
+	if err != nil {
+		return err
+	}
+
+	data := IDData{
+		ID: episodeID.Hex(),
+	}
+	c.JSON(http.StatusOK, NewSuccessResponse(data))
+
+	return nil
+}
+
+func ReadWatchedEpisodesHandler(c *gin.Context, app AppContext) error {
+	seriesID, err := ParseIDParam(c, "id")
+	if err != nil {
+		return err
+	}
+
+	store := app.Store()
+	user, err := ReadSeriesOwner(c, store, seriesID)
+	if err != nil {
+		return err
+	}
+
+	series, err := store.ReadSeries(seriesID)
+	if err != nil {
+		return err
+	}
+
+	episodes, err := store.ReadWatchedEpisodes(user.Id, seriesID)
+	if err != nil {
+		return err
+	}
+	SortEpisodes(episodes, series.Order)
+
+	c.JSON(http.StatusOK, NewSuccessResponse(episodes))
+
+	return nil
+}
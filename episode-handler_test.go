@@ -0,0 +1,375 @@
+package sj
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type EpisodesResponse struct {
+	Status string
+	Data   Episodes
+}
+
+func ParseEpisodesResponse(t *testing.T, b []byte) Episodes {
+	resp := EpisodesResponse{}
+	err := json.Unmarshal(b, &resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resp.Status != "success" {
+		t.Fatal("Expect success response was", string(b))
+	}
+
+	return resp.Data
+}
+
+func Test_POST_EpisodeBatch_OK(t *testing.T) {
+	app := NewTestApp(t)
+	store := app.Store()
+	defer CleanTestStore(store, t)
+
+	_, session, sList := NewTestDBEnv(t, store)
+	auth := SessionAuth(app)
+
+	body := `
+	{
+		"Data": [
+			{
+				"Title": "Pilot",
+				"Session": 1,
+				"Episode": 2
+			},
+			{
+				"Title": "Descenso",
+				"Session": 1,
+				"Episode": 1
+			}
+		]
+	}`
+
+	handler := gin.New()
+	req := TestRequest{
+		Body:    body,
+		Header:  http.Header{},
+		Handler: handler,
+	}
+
+	handler.POST("/series/:id/episodes/batch", auth, NewAppHandler(NewEpisodeBatchHandler, app))
+	handler.GET("/series/:id/episodes", auth, NewAppHandler(ReadEpisodesHandler, app))
+
+	url := fmt.Sprintf("/series/%v/episodes/batch", sList[0].ID.Hex())
+	resp := req.SendWithToken("POST", url, session.Token)
+
+	if resp.Code != http.StatusOK {
+		t.Fatal("Expect", http.StatusOK, "was", resp.Code)
+	}
+
+	req.Body = ""
+	url = fmt.Sprintf("/series/%v/episodes", sList[0].ID.Hex())
+	resp = req.SendWithToken("GET", url, session.Token)
+
+	episodes := ParseEpisodesResponse(t, resp.Body.Bytes())
+	expect := Episodes{
+		{SeriesID: sList[0].ID, Title: "Descenso", Session: 1, Episode: 1},
+		{SeriesID: sList[0].ID, Title: "Pilot", Session: 1, Episode: 2},
+	}
+
+	if len(episodes) != len(expect) {
+		t.Fatal("Expect", expect, "was", episodes)
+	}
+
+	for i, e := range expect {
+		if !EqualEpisode(e, episodes[i]) {
+			t.Fatal("Expect", e, "was", episodes[i])
+		}
+	}
+}
+
+func Test_PUT_WatchEpisode_OK(t *testing.T) {
+	app := NewTestApp(t)
+	store := app.Store()
+	defer CleanTestStore(store, t)
+
+	_, session, sList := NewTestDBEnv(t, store)
+	auth := SessionAuth(app)
+
+	episode := Episode{
+		SeriesID: sList[1].ID,
+		Title:    "eps1.0_hellofriend.mov",
+		Session:  1,
+		Episode:  1,
+	}
+	id, err := store.NewEpisode(episode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := gin.New()
+	req := TestRequest{
+		Body:    "",
+		Header:  http.Header{},
+		Handler: handler,
+	}
+
+	handler.PUT("/episodes/:id/watched", auth, NewAppHandler(WatchEpisodeHandler, app))
+	handler.GET("/series/:id/episodes/watched", auth, NewAppHandler(ReadWatchedEpisodesHandler, app))
+
+	resp := req.SendWithToken("PUT", "/episodes/"+id.Hex()+"/watched", session.Token)
+
+	expectResp := NewSuccessResponse(IDData{ID: id.Hex()})
+	r := EqualSuccessResponse(expectResp, resp.Body, ExistsIDField)
+	if !r {
+		t.Fatal("Expect", expectResp, "was", resp.Body)
+	}
+
+	url := fmt.Sprintf("/series/%v/episodes/watched", sList[1].ID.Hex())
+	resp = req.SendWithToken("GET", url, session.Token)
+
+	episodes := ParseEpisodesResponse(t, resp.Body.Bytes())
+	if len(episodes) != 1 || episodes[0].ID != id {
+		t.Fatal("Expect", id, "was", episodes)
+	}
+}
+
+func Test_POST_Episode_FailForeignSeries(t *testing.T) {
+	app := NewTestApp(t)
+	store := app.Store()
+	defer CleanTestStore(store, t)
+
+	_, session, _ := NewTestDBEnv(t, store)
+	auth := SessionAuth(app)
+
+	body := `
+	{
+		"Data": {
+			"Title": "Pilot",
+			"Session": 1,
+			"Episode": 1
+		}
+	}`
+
+	handler := gin.New()
+	req := TestRequest{
+		Body:    body,
+		Header:  http.Header{},
+		Handler: handler,
+	}
+
+	handler.POST("/series/:id/episodes", auth, NewAppHandler(NewEpisodeHandler, app))
+
+	foreignID := bson.NewObjectId()
+	resp := req.SendWithToken("POST", "/series/"+foreignID.Hex()+"/episodes", session.Token)
+
+	if resp.Code != http.StatusForbidden {
+		t.Fatal("Expect", http.StatusForbidden, "was", resp.Code)
+	}
+
+	m := fmt.Sprintf("Cannot access %v", foreignID.Hex())
+	expectResp := FailResponse{
+		Status: "fail",
+		Err:    m,
+	}
+	err := EqualFailResponse(resp.Body, expectResp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	episodes, err := store.ReadEpisodes(foreignID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(episodes) != 0 {
+		t.Fatal("Expect no episodes was", episodes)
+	}
+}
+
+func Test_DELETE_WatchEpisode_OK(t *testing.T) {
+	app := NewTestApp(t)
+	store := app.Store()
+	defer CleanTestStore(store, t)
+
+	user, session, sList := NewTestDBEnv(t, store)
+	auth := SessionAuth(app)
+
+	// A second user following the same series
+	other := User{
+		Name:   "otherLover",
+		Series: user.Series,
+	}
+	otherID, err := store.NewUser(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	episode := Episode{
+		SeriesID: sList[0].ID,
+		Title:    "Descenso",
+		Session:  1,
+		Episode:  1,
+	}
+	id, err := store.NewEpisode(episode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.WatchEpisode(user.Id, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.WatchEpisode(otherID, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := gin.New()
+	req := TestRequest{
+		Body:    "",
+		Header:  http.Header{},
+		Handler: handler,
+	}
+
+	handler.DELETE("/episodes/:id/watched", auth, NewAppHandler(UnwatchEpisodeHandler, app))
+
+	resp := req.SendWithToken("DELETE", "/episodes/"+id.Hex()+"/watched", session.Token)
+
+	expectResp := NewSuccessResponse(IDData{ID: id.Hex()})
+	r := EqualSuccessResponse(expectResp, resp.Body, ExistsIDField)
+	if !r {
+		t.Fatal("Expect", expectResp, "was", resp.Body)
+	}
+
+	watched, err := store.ReadWatchedEpisodes(user.Id, sList[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(watched) != 0 {
+		t.Fatal("Expect no watched episodes was", watched)
+	}
+
+	watched, err = store.ReadWatchedEpisodes(otherID, sList[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(watched) != 1 {
+		t.Fatal("Expect the other user still watched", id, "was", watched)
+	}
+}
+
+func Test_PUT_WatchEpisode_FailForeignEpisode(t *testing.T) {
+	app := NewTestApp(t)
+	store := app.Store()
+	defer CleanTestStore(store, t)
+
+	_, session, _ := NewTestDBEnv(t, store)
+	auth := SessionAuth(app)
+
+	episode := Episode{
+		SeriesID: bson.NewObjectId(),
+		Title:    "Pilot",
+		Session:  1,
+		Episode:  1,
+	}
+	foreignID, err := store.NewEpisode(episode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := gin.New()
+	handler.PUT("/episodes/:id/watched", auth, NewAppHandler(WatchEpisodeHandler, app))
+
+	// A missing episode has to look like a foreign one
+	for _, id := range []bson.ObjectId{foreignID, bson.NewObjectId()} {
+		req := TestRequest{
+			Body:    "",
+			Header:  http.Header{},
+			Handler: handler,
+		}
+		resp := req.SendWithToken("PUT", "/episodes/"+id.Hex()+"/watched", session.Token)
+
+		if resp.Code != http.StatusForbidden {
+			t.Fatal("Expect", http.StatusForbidden, "was", resp.Code)
+		}
+
+		expectResp := FailResponse{
+			Status: "fail",
+			Err:    fmt.Sprintf("Cannot access %v", id.Hex()),
+		}
+		err := EqualFailResponse(resp.Body, expectResp)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func Test_GET_Episodes_AbsoluteOrder(t *testing.T) {
+	app := NewTestApp(t)
+	store := app.Store()
+	defer CleanTestStore(store, t)
+
+	_, session, sList := NewTestDBEnv(t, store)
+	auth := SessionAuth(app)
+
+	body := `
+	{
+		"Data": [
+			{"Title": "Recap", "Session": 0, "Episode": 1, "Aired": "2015-08-20"},
+			{"Title": "Part 2", "Session": 2, "Episode": 1, "Part": 2, "Absolute": 13},
+			{"Title": "Part 1", "Session": 2, "Episode": 1, "Part": 1, "Absolute": 13},
+			{"Title": "Finale", "Session": 1, "Episode": 12, "Absolute": 12}
+		]
+	}`
+
+	handler := gin.New()
+	req := TestRequest{
+		Body:    body,
+		Header:  http.Header{},
+		Handler: handler,
+	}
+
+	handler.POST("/series/:id/episodes/batch", auth, NewAppHandler(NewEpisodeBatchHandler, app))
+	handler.PATCH("/series/:id", auth, NewAppHandler(UpdateSeriesHandler, app))
+	handler.GET("/series/:id/episodes", auth, NewAppHandler(ReadEpisodesHandler, app))
+
+	url := fmt.Sprintf("/series/%v", sList[0].ID.Hex())
+	resp := req.SendWithToken("POST", url+"/episodes/batch", session.Token)
+	if resp.Code != http.StatusOK {
+		t.Fatal("Expect", http.StatusOK, "was", resp.Code, resp.Body)
+	}
+
+	req.Body = `{"Data": {"Order": "absolute"}}`
+	resp = req.SendWithToken("PATCH", url, session.Token)
+	if resp.Code != http.StatusOK {
+		t.Fatal("Expect", http.StatusOK, "was", resp.Code, resp.Body)
+	}
+
+	req.Body = ""
+	resp = req.SendWithToken("GET", url+"/episodes", session.Token)
+
+	episodes := ParseEpisodesResponse(t, resp.Body.Bytes())
+	expect := []string{"Finale", "Part 1", "Part 2", "Recap"}
+	if len(episodes) != len(expect) {
+		t.Fatal("Expect", expect, "was", episodes)
+	}
+
+	for i, title := range expect {
+		if episodes[i].Title != title {
+			t.Fatal("Expect", title, "was", episodes[i])
+		}
+	}
+
+	aired := time.Date(2015, time.August, 20, 0, 0, 0, 0, time.UTC)
+	if !episodes[3].Aired.Equal(aired) || episodes[2].Part != 2 {
+		t.Fatal("Expect the stored Aired and Part was", episodes)
+	}
+}
@@ -0,0 +1,115 @@
+package sj
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Codes of the APIErrors, clients should check them instead of the
+// messages.
+const (
+	InvalidRequestCode = "invalid_request"
+	InvalidJSONCode    = "invalid_json"
+	MissingFieldCode   = "missing_field"
+	WrongFieldCode     = "wrong_field"
+	UnauthorizedCode   = "unauthorized"
+	ForbiddenCode      = "forbidden"
+	NotFoundCode       = "not_found"
+	InternalCode       = "internal_error"
+)
+
+type (
+	// FieldError describes the problem with one field of a request
+	FieldError struct {
+		Field   string
+		Code    string
+		Message string
+	}
+
+	// APIError is an error which is sent to the client, the status is
+	// the HTTP status of the reply.
+	APIError struct {
+		Status  int
+		Code    string
+		Message string
+		Fields  []FieldError
+	}
+)
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+func NewAPIError(status int, code, msg string) *APIError {
+	return &APIError{
+		Status:  status,
+		Code:    code,
+		Message: msg,
+	}
+}
+
+func NewValidationError(msg string) *APIError {
+	return NewAPIError(http.StatusBadRequest, InvalidRequestCode, msg)
+}
+
+// NewFieldError is a validation error of a single field
+func NewFieldError(code, field, msg string) *APIError {
+	e := NewAPIError(http.StatusBadRequest, code, msg)
+	e.Fields = []FieldError{
+		{
+			Field:   field,
+			Code:    code,
+			Message: msg,
+		},
+	}
+
+	return e
+}
+
+func NewUnauthorizedError(msg string) *APIError {
+	return NewAPIError(http.StatusUnauthorized, UnauthorizedCode, msg)
+}
+
+func NewForbiddenError(msg string) *APIError {
+	return NewAPIError(http.StatusForbidden, ForbiddenCode, msg)
+}
+
+func NewNotFoundError(msg string) *APIError {
+	return NewAPIError(http.StatusNotFound, NotFoundCode, msg)
+}
+
+// Every conflict has its own code, like user_exists, so clients can tell
+// them apart.
+func NewConflictError(code, msg string) *APIError {
+	return NewAPIError(http.StatusConflict, code, msg)
+}
+
+// ToAPIError maps every error to an APIError. Errors which are not meant
+// for the client become an internal error, their message is only logged.
+func ToAPIError(err error) *APIError {
+	switch e := err.(type) {
+	case *APIError:
+		return e
+	case *json.SyntaxError, *json.UnmarshalTypeError:
+		return NewAPIError(http.StatusBadRequest, InvalidJSONCode, e.Error())
+	}
+
+	if err == NotFoundError {
+		return NewNotFoundError("Not found")
+	}
+
+	log.Println(err)
+
+	return NewAPIError(http.StatusInternalServerError, InternalCode, "Internal error")
+}
+
+// AbortWithFail stops the handler chain of a middleware with the
+// FailResponse of the error.
+func AbortWithFail(c *gin.Context, err error) {
+	e := ToAPIError(err)
+	c.JSON(e.Status, NewFailResponse(e))
+	c.Abort()
+}
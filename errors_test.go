@@ -0,0 +1,75 @@
+package sj
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func Test_ToAPIError_OK(t *testing.T) {
+	jsonErr := json.Unmarshal([]byte("{"), &Request[UserBody]{})
+
+	cases := []struct {
+		Err    error
+		Status int
+		Code   string
+	}{
+		{UserExistsError, http.StatusConflict, "user_exists"},
+		{NewMissingFieldError("Title"), http.StatusBadRequest, MissingFieldCode},
+		{NotFoundError, http.StatusNotFound, NotFoundCode},
+		{jsonErr, http.StatusBadRequest, InvalidJSONCode},
+		{errors.New("connection refused"), http.StatusInternalServerError, InternalCode},
+	}
+
+	for _, c := range cases {
+		e := ToAPIError(c.Err)
+		if e.Status != c.Status || e.Code != c.Code {
+			t.Fatal("Expect", c.Status, c.Code, "was", e.Status, e.Code)
+		}
+	}
+
+	// Internal errors do not reach the client
+	e := ToAPIError(errors.New("connection refused"))
+	if e.Message != "Internal error" {
+		t.Fatal("Expect Internal error was", e.Message)
+	}
+}
+
+func Test_POST_Series_FailMissingField(t *testing.T) {
+	app := NewTestApp(t)
+	store := app.Store()
+	defer CleanTestStore(store, t)
+
+	_, session, _ := NewTestDBEnv(t, store)
+
+	handler := gin.New()
+	handler.POST("/series", SessionAuth(app), NewAppHandler(NewSeriesHandler, app))
+
+	req := TestRequest{
+		Body:    `{"Data": {"Title": "Elementary"}}`,
+		Header:  http.Header{},
+		Handler: handler,
+	}
+	resp := req.SendWithToken("POST", "/series", session.Token)
+
+	if resp.Code != http.StatusBadRequest {
+		t.Fatal("Expect", http.StatusBadRequest, "was", resp.Code)
+	}
+
+	fail := FailResponse{}
+	err := json.Unmarshal(resp.Body.Bytes(), &fail)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if fail.Status != "fail" || fail.Code != InvalidFieldsCode {
+		t.Fatal("Expect", InvalidFieldsCode, "was", resp.Body)
+	}
+
+	if len(fail.Fields) != 4 || fail.Fields[0].Code != MissingFieldCode {
+		t.Fatal("Expect the missing fields was", resp.Body)
+	}
+}
@@ -1,32 +1,47 @@
 package sj
 
 import (
-	"bytes"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
-	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/kelseyhightower/envconfig"
-	"github.com/rrawrriw/angular-sauth-handler"
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
 
+const (
+	MongoDriver  = "mongo"
+	MemoryDriver = "memory"
+	SQLiteDriver = "sqlite"
+)
+
 var (
-	RequestError    = errors.New("Request Error")
-	UserExistsError = errors.New("User already exists")
+	UserExistsError = NewConflictError("user_exists", "User already exists")
 )
 
 type (
 	Specs struct {
 		Host      string
 		Port      int
+		DBDriver  string `envconfig:"db_driver"`
 		DBName    string `envconfig:"db_name"`
 		DBURL     string `envconfig:"db_url"`
 		PublicDir string `envconfig:"public_dir"`
+		// How long a session is valid, DefaultSessionExpires when empty
+		SessionExpires time.Duration `envconfig:"session_expires"`
+		// argon2id or bcrypt, argon2id when empty
+		PasswordHasher     string   `envconfig:"password_hasher"`
+		RegistrationClosed bool     `envconfig:"registration_closed"`
+		InviteCodes        []string `envconfig:"invite_codes"`
+		PasswordMinLen     int      `envconfig:"password_min_len"`
+		// Names of the users which get the admin role at the start
+		Admins []string `envconfig:"admins"`
+		// Size limits of request bodies in bytes, the defaults when empty
+		MaxBodySize      int64 `envconfig:"max_body_size"`
+		MaxBatchBodySize int64 `envconfig:"max_batch_body_size"`
 	}
 
 	SuccessResponse struct {
@@ -34,23 +49,57 @@ type (
 		Data   interface{}
 	}
 
+	// Code and Fields are set for every error, Err is kept for older
+	// clients.
 	FailResponse struct {
 		Status string
 		Err    string
+		Code   string
+		Fields []FieldError `json:",omitempty"`
+	}
+
+	// UserBody is the Data of the user requests, nil fields are missing
+	UserBody struct {
+		Name     *string
+		Password *string
+	}
+
+	// SeriesBody is the Data of a new series, every field is required
+	SeriesBody struct {
+		Title    *string
+		Image    *ResourcesBody
+		Desc     *ResourcesBody
+		Episodes *ResourcesBody
+		Portal   *ResourcesBody
+		// Optional, the SeasonOrder if it is missing
+		Order *string
 	}
 
-	JSONRequest struct {
-		Data interface{}
+	// ChangeSeriesBody is the Data of a series change, only the fields
+	// that are part of the request are changed.
+	ChangeSeriesBody struct {
+		Title    *string
+		Image    *ResourceChangeBody
+		Desc     *ResourceChangeBody
+		Episodes *ResourceChangeBody
+		Portal   *ResourceChangeBody
+		Order    *string
 	}
 
 	AppContext interface {
-		DB() *mgo.Database
+		Store() Store
+		SessionExpires() time.Duration
+		RegistrationPolicy() RegistrationPolicy
+		Passwords() PasswordHashers
+		Now() time.Time
 	}
 
 	AppCtx struct {
-		Mutex      *sync.Mutex
 		MgoSession *mgo.Session
 		Specs      Specs
+		Backend    Store
+		// Clock replaces time.Now in tests, nil is time.Now
+		Clock func() time.Time
 	}
 
 	AppHandler func(*gin.Context, AppContext) error
@@ -60,13 +109,62 @@ type (
 	}
 )
 
-func (app AppCtx) DB() *mgo.Database {
-	app.Mutex.Lock()
-	defer app.Mutex.Unlock()
+func (app AppCtx) Store() Store {
+	return app.Backend
+}
+
+func (app AppCtx) SessionExpires() time.Duration {
+	if app.Specs.SessionExpires <= 0 {
+		return DefaultSessionExpires
+	}
+
+	return app.Specs.SessionExpires
+}
+
+func (app AppCtx) MaxBodySize() int64 {
+	if app.Specs.MaxBodySize <= 0 {
+		return DefaultMaxBodySize
+	}
+
+	return app.Specs.MaxBodySize
+}
 
-	sCopy := app.MgoSession.Copy()
+// MaxBatchBodySize is the limit of the batch endpoints like the episode
+// import.
+func (app AppCtx) MaxBatchBodySize() int64 {
+	if app.Specs.MaxBatchBodySize <= 0 {
+		return DefaultMaxBatchBodySize
+	}
+
+	return app.Specs.MaxBatchBodySize
+}
 
-	return sCopy.DB(app.Specs.DBName)
+func (app AppCtx) RegistrationPolicy() RegistrationPolicy {
+	return NewRegistrationPolicy(app.Specs)
+}
+
+// Passwords hashes with the PasswordHasher of the Specs, NewApp rejects
+// unknown hashers.
+func (app AppCtx) Passwords() PasswordHashers {
+	p, err := NewPasswordHashers(app.Specs.PasswordHasher)
+	if err != nil {
+		p, _ = NewPasswordHashers("")
+	}
+
+	return p
+}
+
+// Now is the time the two-factor codes are checked against
+func (app AppCtx) Now() time.Time {
+	if app.Clock == nil {
+		return time.Now()
+	}
+
+	return app.Clock()
+}
+
+func (app AppCtx) Close() error {
+	return app.Backend.Close()
 }
 
 func NewApp(appNamePrefix string) (AppCtx, error) {
@@ -76,16 +174,58 @@ func NewApp(appNamePrefix string) (AppCtx, error) {
 		return AppCtx{}, err
 	}
 
-	url := specs.DBURL
-	session, err := mgo.Dial(url)
+	ctx := AppCtx{
+		Specs: specs,
+	}
+
+	_, err = NewPasswordHashers(specs.PasswordHasher)
 	if err != nil {
 		return AppCtx{}, err
 	}
 
-	ctx := AppCtx{
-		MgoSession: session,
-		Specs:      specs,
-		Mutex:      &sync.Mutex{},
+	switch specs.DBDriver {
+	case "", MongoDriver:
+		url := specs.DBURL
+		session, err := mgo.Dial(url)
+		if err != nil {
+			return AppCtx{}, err
+		}
+
+		err = MigrateMgo(session.DB(specs.DBName), MgoMigrations)
+		if err != nil {
+			session.Close()
+			return AppCtx{}, err
+		}
+
+		ctx.MgoSession = session
+		ctx.Backend = NewMgoStore(session, specs.DBName)
+	case MemoryDriver:
+		ctx.Backend = NewMemStore()
+	case SQLiteDriver:
+		// DBURL is the path of the database file
+		store, err := NewSQLiteStore(specs.DBURL)
+		if err != nil {
+			return AppCtx{}, err
+		}
+
+		ctx.Backend = store
+	default:
+		m := fmt.Sprintf("Unknown db driver %v", specs.DBDriver)
+		return AppCtx{}, errors.New(m)
+	}
+
+	// Finish the writes interrupted by the last shutdown, younger ones
+	// may belong to another instance and are left to RecoverEvery
+	err = NewJournal(ctx.Backend).Recover(ctx.Now().Add(-JournalGrace))
+	if err != nil {
+		ctx.Close()
+		return AppCtx{}, err
+	}
+
+	err = PromoteAdmins(ctx.Backend, specs.Admins)
+	if err != nil {
+		ctx.Close()
+		return AppCtx{}, err
 	}
 
 	return ctx, nil
@@ -101,9 +241,12 @@ func NewSuccessResponse(d interface{}) SuccessResponse {
 }
 
 func NewFailResponse(err error) FailResponse {
+	e := ToAPIError(err)
 	resp := FailResponse{
 		Status: "fail",
-		Err:    fmt.Sprintf("%v", err),
+		Err:    e.Message,
+		Code:   e.Code,
+		Fields: e.Fields,
 	}
 
 	return resp
@@ -111,81 +254,22 @@ func NewFailResponse(err error) FailResponse {
 
 func NewMissingFieldError(field string) error {
 	msg := fmt.Sprintf("%v is missing", field)
-	return errors.New(msg)
+	return NewFieldError(MissingFieldCode, field, msg)
 }
 
-func ExistsFields(s map[string]interface{}, f []string) error {
-	for _, v := range f {
-		_, ok := s[v]
-		if !ok {
-			return NewMissingFieldError(v)
-		}
-	}
-
-	return nil
-}
-
-func ExportResource(s map[string]interface{}, key string) (Resource, error) {
-	v, ok := s[key].(map[string]interface{})
-	if !ok {
-		return Resource{}, NewMissingFieldError(key)
-	}
-
-	name, ok := v["Name"].(string)
-	if !ok {
-		return Resource{}, NewMissingFieldError("Name")
-	}
-
-	url, ok := v["URL"].(string)
-	if !ok {
-		return Resource{}, NewMissingFieldError("URL")
-	}
-
-	r := Resource{
-		Name: name,
-		URL:  url,
-	}
-
-	return r, nil
-
+func NewWrongFieldError(field string) error {
+	msg := fmt.Sprintf("Wrong %v field", field)
+	return NewFieldError(WrongFieldCode, field, msg)
 }
 
-func ParseJSONRequest(r *http.Request) (JSONRequest, error) {
-	buf := bytes.NewBuffer([]byte{})
-	_, err := buf.ReadFrom(r.Body)
+func ParseUserBody(body UserBody) (User, error) {
+	v := &Validator{}
+	name, _ := v.String("Name", body.Name, 0)
+	pass, _ := v.String("Password", body.Password, 0)
 
-	req := JSONRequest{}
-	err = json.Unmarshal(buf.Bytes(), &req)
+	err := v.Err()
 	if err != nil {
-		return JSONRequest{}, err
-	}
-
-	return req, nil
-}
-
-func ParseUserDataRequest(req JSONRequest) (User, error) {
-	d, ok := req.Data.(map[string]interface{})
-	if !ok {
-		return User{}, errors.New("Wrong user request")
-	}
-
-	n, ok := d["Name"]
-	if !ok {
-		return User{}, NewMissingFieldError("Name")
-	}
-	p, ok := d["Password"]
-	if !ok {
-		return User{}, NewMissingFieldError("Password")
-	}
-
-	name, ok := n.(string)
-	if !ok {
-		return User{}, errors.New("Wrong name field")
-	}
-
-	pass, ok := p.(string)
-	if !ok {
-		return User{}, errors.New("Wrong password field")
+		return User{}, err
 	}
 
 	user := User{
@@ -194,92 +278,82 @@ func ParseUserDataRequest(req JSONRequest) (User, error) {
 	}
 
 	return user, nil
-
 }
 
 func ParseNewUserRequest(r *http.Request) (User, error) {
-	req, err := ParseJSONRequest(r)
-	if err != nil {
-		return User{}, err
-	}
-
-	user, err := ParseUserDataRequest(req)
+	body, err := DecodeRequest[UserBody](r)
 	if err != nil {
 		return User{}, err
 	}
 
-	return user, nil
+	return ParseUserBody(body)
 }
 
 func ParseNewSeriesRequest(c *gin.Context) (Series, error) {
-	buf := bytes.NewBuffer([]byte{})
-	_, err := buf.ReadFrom(c.Request.Body)
-
-	req := JSONRequest{}
-	err = json.Unmarshal(buf.Bytes(), &req)
+	body, err := DecodeRequest[SeriesBody](c.Request)
 	if err != nil {
 		return Series{}, err
 	}
 
-	data, ok := req.Data.(interface{})
-	if !ok {
-		return Series{}, RequestError
+	v := &Validator{}
+	title, ok := v.String("Title", body.Title, MaxTitleLen)
+	if ok {
+		v.NotEmpty("Title", title)
 	}
 
-	m, ok := data.(map[string]interface{})
-	if !ok {
-		return Series{}, RequestError
+	series := Series{
+		Title:    title,
+		Image:    v.Resources(body.Image, "Image"),
+		Desc:     v.Resources(body.Desc, "Desc"),
+		Episodes: v.Resources(body.Episodes, "Episodes"),
+		Portal:   v.Resources(body.Portal, "Portal"),
+		Order:    v.Order("Order", body.Order),
 	}
 
-	fields := []string{
-		"Title",
-		"Image",
-		"Desc",
-		"Episodes",
-		"Portal",
-	}
-	err = ExistsFields(m, fields)
+	err = v.Err()
 	if err != nil {
 		return Series{}, err
 	}
 
-	title, ok := m["Title"].(string)
-	if !ok {
-		return Series{}, NewMissingFieldError("Title")
-	}
+	return series, nil
+}
 
-	resources := map[string]Resource{}
-	resourceNames := []string{
-		"Image",
-		"Desc",
-		"Episodes",
-		"Portal",
+func ParseChangeSeriesRequest(r *http.Request) (ChangeSeries, error) {
+	body, err := DecodeRequest[ChangeSeriesBody](r)
+	if err != nil {
+		return ChangeSeries{}, err
 	}
-	for _, key := range resourceNames {
-		v, err := ExportResource(m, key)
-		if err != nil {
-			return Series{}, err
+
+	v := &Validator{}
+	change := ChangeSeries{}
+	if body.Title != nil {
+		title, ok := v.String("Title", body.Title, MaxTitleLen)
+		if ok {
+			v.NotEmpty("Title", title)
 		}
-		resources[key] = v
+		change.Title = title
 	}
 
-	series := Series{
-		Title:    title,
-		Image:    resources["Image"],
-		Desc:     resources["Desc"],
-		Episodes: resources["Episodes"],
-		Portal:   resources["Portal"],
+	change.Image = v.ResourceChange(body.Image, "Image")
+	change.Desc = v.ResourceChange(body.Desc, "Desc")
+	change.Episodes = v.ResourceChange(body.Episodes, "Episodes")
+	change.Portal = v.ResourceChange(body.Portal, "Portal")
+	change.Order = v.Order("Order", body.Order)
+
+	err = v.Err()
+	if err != nil {
+		return ChangeSeries{}, err
 	}
 
-	return series, nil
+	return change, nil
 }
 
 func ContextErrorDeco(h AppHandler, app AppContext) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		err := h(c, app)
 		if err != nil {
-			resp := NewFailResponse(err)
-			c.JSON(http.StatusOK, resp)
+			e := ToAPIError(err)
+			c.JSON(e.Status, NewFailResponse(e))
 			return
 		}
 	}
@@ -300,10 +374,10 @@ func EmptyResource(r Resource) bool {
 
 func EmptySeries(s Series) bool {
 	if s.Title == "" &&
-		EmptyResource(s.Image) &&
-		EmptyResource(s.Desc) &&
-		EmptyResource(s.Episodes) &&
-		EmptyResource(s.Portal) {
+		len(s.Image) == 0 &&
+		len(s.Desc) == 0 &&
+		len(s.Episodes) == 0 &&
+		len(s.Portal) == 0 {
 		return true
 	}
 
@@ -326,123 +400,142 @@ func NewSeriesHandler(c *gin.Context, app AppContext) error {
 		return err
 	}
 
-	if EmptySeries(series) {
-		return errors.New("Wrong request")
+	store := app.Store()
+	user, err := ReadSessionUser(c, store)
+	if err != nil {
+		return err
 	}
 
-	db := app.DB()
-	defer db.Session.Close()
-	id, err := NewSeries(db, series)
+	id, err := NewJournal(store).NewSeriesOfUser(user.Id, series)
 	if err != nil {
 		return err
 	}
 
-	session, err := aauth.ReadSession(c)
+	data := IDData{
+		ID: string(id.Hex()),
+	}
+	c.JSON(http.StatusOK, NewSuccessResponse(data))
+	return nil
+}
+
+func RemoveSeriesHandler(c *gin.Context, app AppContext) error {
+	seriesID, err := ParseIDParam(c, "id")
 	if err != nil {
 		return err
 	}
 
-	ids := []bson.ObjectId{
-		id,
-	}
-	change := ChangeUser{
-		Series: AppendIDItems(ids),
+	store := app.Store()
+	user, err := ReadSeriesOwner(c, store, seriesID)
+	if err != nil {
+		return err
 	}
 
-	uID := bson.ObjectIdHex(session.UserID)
-	err = UpdateUser(db, uID, change)
+	// The series, his episodes and watch records are only removed when
+	// no other user follows the series.
+	err = NewJournal(store).RemoveSeriesOfUser(user.Id, seriesID)
 	if err != nil {
 		return err
 	}
 
-	data := IDData{
-		ID: string(id.Hex()),
+	respID := IDData{
+		ID: seriesID.Hex(),
 	}
-	c.JSON(http.StatusOK, NewSuccessResponse(data))
+	resp := NewSuccessResponse(respID)
+	c.JSON(http.StatusOK, resp)
+
 	return nil
+
 }
 
-func RemoveSeriesHandler(c *gin.Context, app AppContext) error {
+func UpdateSeriesHandler(c *gin.Context, app AppContext) error {
+	seriesID, err := ParseIDParam(c, "id")
+	if err != nil {
+		return err
+	}
 
-	seriesIDParam := c.Params.ByName("id")
-	if seriesIDParam == "" {
-		return errors.New("Missing id parameter")
+	change, err := ParseChangeSeriesRequest(c.Request)
+	if err != nil {
+		return err
 	}
 
-	seriesID := bson.ObjectIdHex(seriesIDParam)
+	if change.Title == "" &&
+		change.Image == nil &&
+		change.Desc == nil &&
+		change.Episodes == nil &&
+		change.Portal == nil &&
+		change.Order == "" {
+		return NewValidationError("Wrong request")
+	}
 
-	session, err := aauth.ReadSession(c)
+	// Followers share the series, only its owner changes it for all
+	store := app.Store()
+	_, err = ReadSeriesEditor(c, store, seriesID)
 	if err != nil {
 		return err
 	}
 
-	db := app.DB()
-	defer db.Session.Close()
-	userID := bson.ObjectIdHex(session.UserID)
-	user, err := ReadUser(db, userID)
+	err = store.UpdateSeries(seriesID, change)
 	if err != nil {
 		return err
 	}
 
-	if !ContainsID(user.Series, seriesID) {
-		m := fmt.Sprintf("Cannot find %v", seriesID)
-		return errors.New(m)
+	series, err := store.ReadSeries(seriesID)
+	if err != nil {
+		return err
 	}
 
-	// todo(tochti): Remove all episodes
+	c.JSON(http.StatusOK, NewSuccessResponse(series))
 
-	ids := []bson.ObjectId{
-		seriesID,
-	}
-	change := ChangeUser{
-		Series: RemoveIDItems(ids),
+	return nil
+}
+
+// Returns the series with the progress of the session user
+func ReadSeriesHandler(c *gin.Context, app AppContext) error {
+	seriesID, err := ParseIDParam(c, "id")
+	if err != nil {
+		return err
 	}
-	err = UpdateUser(db, userID, change)
+
+	store := app.Store()
+	user, err := ReadSeriesOwner(c, store, seriesID)
 	if err != nil {
 		return err
 	}
 
-	err = RemoveSeries(db, seriesID)
+	series, err := store.ReadSeries(seriesID)
 	if err != nil {
-		// If it not possible to remove the series reset the user series link
-		change := ChangeUser{
-			Series: AppendIDItems(ids),
-		}
-		UpdateUser(db, userID, change)
+		return err
+	}
 
+	progress, err := ReadSeriesProgress(store, user.Id, series)
+	if err != nil {
 		return err
 	}
 
-	respID := IDData{
-		ID: seriesIDParam,
+	data := SeriesDetailData{
+		Series:   series,
+		Progress: progress,
 	}
-	resp := NewSuccessResponse(respID)
-	c.JSON(http.StatusOK, resp)
+	c.JSON(http.StatusOK, NewSuccessResponse(data))
 
 	return nil
-
 }
 
+// Returns the series of the user of the id parameter, the session user
+// sees his own series and the series which are shared with him.
 func ReadSeriesOfUserHandler(c *gin.Context, app AppContext) error {
-	tmp, err := c.Get("Session")
+	ownerID, err := ParseIDParam(c, "id")
 	if err != nil {
 		return err
 	}
 
-	s, ok := tmp.(aauth.Session)
-	if !ok {
-		errors.New("Cannot find session")
-	}
-
-	userID := c.Params.ByName("id")
-	if s.UserID == userID {
-		errors.New("Wrong user")
+	store := app.Store()
+	err = AuthorizeSeriesOfUser(c, store, ownerID)
+	if err != nil {
+		return err
 	}
 
-	db := app.DB()
-	defer db.Session.Close()
-	sList, err := ReadSeriesOfUser(db, bson.ObjectIdHex(s.UserID))
-
+	sList, err := store.ReadSeriesOfUser(ownerID)
 	if err != nil {
 		return err
 	}
@@ -454,24 +547,24 @@ func ReadSeriesOfUserHandler(c *gin.Context, app AppContext) error {
 }
 
 func NewUserHandler(c *gin.Context, app AppContext) error {
-	user, err := ParseNewUserRequest(c.Request)
+	reg, err := ParseRegistrationRequest(c.Request)
 	if err != nil {
 		return err
 	}
 
-	db := app.DB()
-	defer db.Session.Close()
-
-	_, err = FindUser(db, user.Name)
-	if err == nil {
-		return UserExistsError
+	err = app.RegistrationPolicy().Check(reg)
+	if err != nil {
+		return err
 	}
 
-	if err.Error() != "not found" {
+	hash, err := app.Passwords().Hash(reg.User.Pass)
+	if err != nil {
 		return err
 	}
+	reg.User.Pass = hash
 
-	id, err := NewUser(db, user)
+	// The store reports a taken name with UserExistsError
+	id, err := app.Store().NewUser(reg.User)
 	if err != nil {
 		return err
 	}
@@ -7,26 +7,23 @@ import (
 	"fmt"
 	"net/http"
 	"sort"
-	"sync"
 	"testing"
 	"time"
 
-	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rrawrriw/angular-sauth-handler"
 )
 
-func NewTestSession(user, token string, db *mgo.Database, t *testing.T) aauth.Session {
-	coll := db.C(TestSessionsColl)
+func NewTestSession(user, token string, store Store, t *testing.T) aauth.Session {
 	expires := time.Now().AddDate(0, 0, 1)
 	session := aauth.Session{
 		Token:   token,
 		UserID:  user,
 		Expires: expires,
 	}
-	err := coll.Insert(session)
+	err := store.NewSession(session)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -34,31 +31,41 @@ func NewTestSession(user, token string, db *mgo.Database, t *testing.T) aauth.Se
 	return session
 }
 
+// NewTestPasswordHash hashes like the app does, the stores save the hash
+func NewTestPasswordHash(t *testing.T, password string) string {
+	hash, err := AppCtx{}.Passwords().Hash(password)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return hash
+}
+
 // Erzeuge standard Benutzer und Serien in der Datenbank für Testzwecke
-func NewTestDBEnv(t *testing.T, db *mgo.Database) (User, aauth.Session, SeriesList) {
+func NewTestDBEnv(t *testing.T, store Store) (User, aauth.Session, SeriesList) {
 	userName := "greatLover99"
 
 	series1 := Series{
 		Title: "Narcos",
-		Image: Resource{
+		Image: Resources{{
 			"kinox.to",
 			"http://kinox.to/Stream/Narcos.html",
-		},
-		Episodes: Resource{
+		}},
+		Episodes: Resources{{
 			"imdb.com",
 			"http://www.imdb.com/title/tt2707408",
-		},
-		Desc: Resource{
+		}},
+		Desc: Resources{{
 			"imdb.com",
 			"http://www.imdb.com/title/tt2707408",
-		},
-		Portal: Resource{
+		}},
+		Portal: Resources{{
 			"kinox.to",
 			"http://kinox.to/Stream/Narcos.html",
-		},
+		}},
 	}
 
-	id1, err := NewSeries(db, series1)
+	id1, err := store.NewSeries(series1)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -66,25 +73,25 @@ func NewTestDBEnv(t *testing.T, db *mgo.Database) (User, aauth.Session, SeriesLi
 
 	series2 := Series{
 		Title: "Mr. Robot",
-		Image: Resource{
+		Image: Resources{{
 			"imdb.com",
 			"http://www.imdb.com/title/tt4158110/",
-		},
-		Episodes: Resource{
+		}},
+		Episodes: Resources{{
 			"serienjunkie.de",
 			"http://www.serienjunkies.de/mr-robot/",
-		},
-		Desc: Resource{
+		}},
+		Desc: Resources{{
 			"serienjunkie.de",
 			"http://www.serienjunkies.de/mr-robot/",
-		},
-		Portal: Resource{
+		}},
+		Portal: Resources{{
 			"kinox.to",
 			"http://kinox.to/Stream/Mr-Robot.html",
-		},
+		}},
 	}
 
-	id2, err := NewSeries(db, series2)
+	id2, err := store.NewSeries(series2)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -100,14 +107,14 @@ func NewTestDBEnv(t *testing.T, db *mgo.Database) (User, aauth.Session, SeriesLi
 		Series: ids,
 	}
 
-	uID, err := NewUser(db, user)
+	uID, err := store.NewUser(user)
 	if err != nil {
 		t.Fatal(err)
 	}
 	user.Id = uID
 
 	userToken := "123"
-	session := NewTestSession(string(uID.Hex()), userToken, db, t)
+	session := NewTestSession(string(uID.Hex()), userToken, store, t)
 
 	sList := SeriesList{
 		series1,
@@ -157,18 +164,27 @@ func ParseSeriesList(r SuccessResponse) (SeriesList, error) {
 		}
 
 		fName := []string{"Image", "Desc", "Episodes", "Portal"}
-		fields := map[string]Resource{}
+		fields := map[string]Resources{}
 
 		for _, name := range fName {
-			v, ok := tmp[name].(map[string]interface{})
+			l, ok := tmp[name].([]interface{})
 			if !ok {
 				return SeriesList{}, cErr
 			}
-			r := Resource{
-				Name: v["Name"].(string),
-				URL:  v["URL"].(string),
+
+			resources := Resources{}
+			for _, e := range l {
+				v, ok := e.(map[string]interface{})
+				if !ok {
+					return SeriesList{}, cErr
+				}
+				r := Resource{
+					Name: v["Name"].(string),
+					URL:  v["URL"].(string),
+				}
+				resources = append(resources, r)
 			}
-			fields[name] = r
+			fields[name] = resources
 		}
 
 		series := Series{
@@ -257,16 +273,19 @@ func ExistsIDField(r1, r2 SuccessResponse) bool {
 }
 
 func NewTestApp(t *testing.T) AppCtx {
-	s, _ := DialTestDB(t)
 	specs := Specs{
 		DBName: TestDBName,
 		DBURL:  TestDBURL,
 	}
 
 	ctx := AppCtx{
-		MgoSession: s,
-		Specs:      specs,
-		Mutex:      &sync.Mutex{},
+		Specs:   specs,
+		Backend: NewTestStore(t),
+	}
+
+	s, ok := ctx.Backend.(MgoStore)
+	if ok {
+		ctx.MgoSession = s.Session
 	}
 
 	return ctx
@@ -274,11 +293,11 @@ func NewTestApp(t *testing.T) AppCtx {
 
 func Test_GET_SeriesOfUser_OK(t *testing.T) {
 	app := NewTestApp(t)
-	db := app.DB()
-	defer CleanTestDB(app.MgoSession, db, t)
+	store := app.Store()
+	defer CleanTestStore(store, t)
 
-	user, session, sList := NewTestDBEnv(t, db)
-	auth := aauth.AngularAuth(db, TestSessionsColl)
+	user, session, sList := NewTestDBEnv(t, store)
+	auth := SessionAuth(app)
 
 	handler := gin.New()
 	req := TestRequest{
@@ -290,7 +309,7 @@ func Test_GET_SeriesOfUser_OK(t *testing.T) {
 	h := NewAppHandler(ReadSeriesOfUserHandler, app)
 	handler.GET("/:id", auth, h)
 
-	url := fmt.Sprintf("/%v", user.ID)
+	url := fmt.Sprintf("/%v", user.Id.Hex())
 	resp := req.SendWithToken("GET", url, session.Token)
 
 	if resp.Code != http.StatusOK {
@@ -308,12 +327,12 @@ func Test_GET_SeriesOfUser_OK(t *testing.T) {
 
 func Test_POST_Series_OK(t *testing.T) {
 	app := NewTestApp(t)
-	db := app.DB()
-	defer CleanTestDB(app.MgoSession, db, t)
+	store := app.Store()
+	defer CleanTestStore(store, t)
 
-	_, session, _ := NewTestDBEnv(t, db)
+	_, session, _ := NewTestDBEnv(t, store)
 
-	auth := aauth.AngularAuth(db, TestSessionsColl)
+	auth := SessionAuth(app)
 
 	body := `
 	{
@@ -364,12 +383,12 @@ func Test_POST_Series_OK(t *testing.T) {
 
 func Test_DELETE_Series_OK(t *testing.T) {
 	app := NewTestApp(t)
-	db := app.DB()
-	defer CleanTestDB(app.MgoSession, db, t)
+	store := app.Store()
+	defer CleanTestStore(store, t)
 
-	_, session, sList := NewTestDBEnv(t, db)
+	_, session, sList := NewTestDBEnv(t, store)
 
-	auth := aauth.AngularAuth(db, TestSessionsColl)
+	auth := SessionAuth(app)
 
 	handler := gin.New()
 	req := TestRequest{
@@ -417,23 +436,34 @@ func Test_ParseNewSeriesRequest_FailMissingFields(t *testing.T) {
 	ginCtx.Request = req
 
 	_, err = ParseNewSeriesRequest(&ginCtx)
-	expect := NewMissingFieldError("Image")
-	if err.Error() != expect.Error() {
-		t.Fatal("Expect", expect, "was", err)
+	apiErr, ok := err.(*APIError)
+	if !ok {
+		t.Fatal("Expect an APIError was", err)
+	}
+
+	expect := []string{"Image", "Desc", "Episodes", "Portal"}
+	if len(apiErr.Fields) != len(expect) {
+		t.Fatal("Expect", expect, "was", apiErr.Fields)
+	}
+
+	for i, f := range apiErr.Fields {
+		if f.Field != expect[i] || f.Code != MissingFieldCode {
+			t.Fatal("Expect", expect[i], "was", f)
+		}
 	}
 }
 
 func Test_POST_NewUser_OK(t *testing.T) {
 	app := NewTestApp(t)
-	db := app.DB()
-	defer CleanTestDB(app.MgoSession, db, t)
+	store := app.Store()
+	defer CleanTestStore(store, t)
 
 	handler := gin.New()
 	newUserBody := `
 	{
 		"Data": {
 			"Name": "machine_XXX",
-			"Password": "love!"
+			"Password": "love!machine"
 		}
 	}
 	`
@@ -458,14 +488,14 @@ func Test_POST_NewUser_OK(t *testing.T) {
 
 func Test_POST_NewUser_FailUserExists(t *testing.T) {
 	app := NewTestApp(t)
-	db := app.DB()
-	defer CleanTestDB(app.MgoSession, db, t)
+	store := app.Store()
+	defer CleanTestStore(store, t)
 
 	user := User{
 		Name: "machine_XXX",
 		Pass: "love!",
 	}
-	_, err := NewUser(db, user)
+	_, err := store.NewUser(user)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -475,7 +505,7 @@ func Test_POST_NewUser_FailUserExists(t *testing.T) {
 	{
 		"Data": {
 			"Name": "machine_XXX",
-			"Password": "love!"
+			"Password": "love!machine"
 		}
 	}
 	`
@@ -528,3 +558,245 @@ func Test_ParseNewUserRequest_OK(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func Test_PATCH_Series_OK(t *testing.T) {
+	app := NewTestApp(t)
+	store := app.Store()
+	defer CleanTestStore(store, t)
+
+	_, session, sList := NewTestDBEnv(t, store)
+	auth := SessionAuth(app)
+
+	body := `
+	{
+		"Data": {
+			"Title": "Narcos: Mexico",
+			"Portal": {
+				"Name": "netflix.com",
+				"URL": "https://www.netflix.com/title/80997085"
+			}
+		}
+	}`
+
+	handler := gin.New()
+	req := TestRequest{
+		Body:    body,
+		Header:  http.Header{},
+		Handler: handler,
+	}
+
+	h := NewAppHandler(UpdateSeriesHandler, app)
+	handler.PATCH("/:id", auth, h)
+
+	seriesID := sList[0].ID
+	resp := req.SendWithToken("PATCH", "/"+seriesID.Hex(), session.Token)
+
+	if resp.Code != http.StatusOK {
+		t.Fatal("Expect", http.StatusOK, "was", resp.Code)
+	}
+
+	expect := sList[0]
+	expect.Title = "Narcos: Mexico"
+	expect.Portal = Resources{{
+		"netflix.com",
+		"https://www.netflix.com/title/80997085",
+	}}
+
+	seriesResp := struct {
+		Status string
+		Data   Series
+	}{}
+	err := json.Unmarshal(resp.Body.Bytes(), &seriesResp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if seriesResp.Status != "success" || !EqualSeries(expect, seriesResp.Data) {
+		t.Fatal("Expect", expect, "was", resp.Body)
+	}
+
+	result, err := store.ReadSeries(seriesID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !EqualSeries(expect, result) {
+		t.Fatal("Expect", expect, "was", result)
+	}
+}
+
+func Test_PATCH_Series_FailForeignSeries(t *testing.T) {
+	app := NewTestApp(t)
+	store := app.Store()
+	defer CleanTestStore(store, t)
+
+	_, session, _ := NewTestDBEnv(t, store)
+	auth := SessionAuth(app)
+
+	foreign := Series{
+		Title: "Elementary",
+	}
+	foreignID, err := store.NewSeries(foreign)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := `
+	{
+		"Data": {
+			"Title": "Sherlock"
+		}
+	}`
+
+	handler := gin.New()
+	req := TestRequest{
+		Body:    body,
+		Header:  http.Header{},
+		Handler: handler,
+	}
+
+	h := NewAppHandler(UpdateSeriesHandler, app)
+	handler.PATCH("/:id", auth, h)
+
+	resp := req.SendWithToken("PATCH", "/"+foreignID.Hex(), session.Token)
+
+	if resp.Code != http.StatusForbidden {
+		t.Fatal("Expect", http.StatusForbidden, "was", resp.Code)
+	}
+
+	m := fmt.Sprintf("Cannot access %v", foreignID.Hex())
+	err = EqualFailResponse(resp.Body, FailResponse{Status: "fail", Err: m})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := store.ReadSeries(foreignID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Title != foreign.Title {
+		t.Fatal("Expect", foreign.Title, "was", result.Title)
+	}
+}
+
+// Both users follow the series, only its owner changes it
+func Test_PATCH_Series_FailFollower(t *testing.T) {
+	env := NewTestEnv(t)
+	store := env.Store
+	defer env.Close()
+
+	owner := env.NewUser("greatLover99", "secret")
+	ownerSession := env.NewSession(owner, "123")
+	follower := env.NewUser("otherLover", "secret")
+	session := env.NewSession(follower, "456")
+
+	seriesID, err := NewJournal(store).NewSeriesOfUser(owner.Id, Series{Title: "Narcos"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.UpdateUser(follower.Id, ChangeUser{Series: AppendIDItems{seriesID}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := env.Request(`{"Data": {"Title": "Narcos: Mexico"}}`)
+	resp := req.SendWithToken("PATCH", "/series/"+seriesID.Hex(), session.Token)
+	if resp.Code != http.StatusForbidden {
+		t.Fatal("Expect", http.StatusForbidden, "was", resp.Code, resp.Body)
+	}
+
+	result, err := store.ReadSeries(seriesID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Title != "Narcos" {
+		t.Fatal("Expect Narcos was", result.Title)
+	}
+
+	req = env.Request(`{"Data": {"Title": "Narcos: Mexico"}}`)
+	resp = req.SendWithToken("PATCH", "/series/"+seriesID.Hex(), ownerSession.Token)
+	if resp.Code != http.StatusOK {
+		t.Fatal("Expect", http.StatusOK, "was", resp.Code, resp.Body)
+	}
+
+	// Once the owner leaves the series every follower may change it
+	err = NewJournal(store).RemoveSeriesOfUser(owner.Id, seriesID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req = env.Request(`{"Data": {"Title": "Narcos"}}`)
+	resp = req.SendWithToken("PATCH", "/series/"+seriesID.Hex(), session.Token)
+	if resp.Code != http.StatusOK {
+		t.Fatal("Expect", http.StatusOK, "was", resp.Code, resp.Body)
+	}
+}
+
+func Test_PATCH_SeriesResources_OK(t *testing.T) {
+	app := NewTestApp(t)
+	store := app.Store()
+	defer CleanTestStore(store, t)
+
+	_, session, sList := NewTestDBEnv(t, store)
+	auth := SessionAuth(app)
+
+	body := `
+	{
+		"Data": {
+			"Portal": {
+				"Append": [
+					{
+						"Name": "netflix.com",
+						"URL": "https://www.netflix.com/title/80025172"
+					}
+				]
+			},
+			"Desc": {
+				"Remove": [
+					{
+						"Name": "imdb.com",
+						"URL": "http://www.imdb.com/title/tt2707408"
+					}
+				]
+			},
+			"Image": []
+		}
+	}`
+
+	handler := gin.New()
+	req := TestRequest{
+		Body:    body,
+		Header:  http.Header{},
+		Handler: handler,
+	}
+
+	h := NewAppHandler(UpdateSeriesHandler, app)
+	handler.PATCH("/:id", auth, h)
+
+	seriesID := sList[0].ID
+	resp := req.SendWithToken("PATCH", "/"+seriesID.Hex(), session.Token)
+
+	if resp.Code != http.StatusOK {
+		t.Fatal("Expect", http.StatusOK, "was", resp.Code)
+	}
+
+	expect := sList[0]
+	expect.Portal = append(expect.Portal, Resource{
+		"netflix.com",
+		"https://www.netflix.com/title/80025172",
+	})
+	expect.Desc = Resources{}
+	expect.Image = Resources{}
+
+	result, err := store.ReadSeries(seriesID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !EqualSeries(expect, result) {
+		t.Fatal("Expect", expect, "was", result)
+	}
+}
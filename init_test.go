@@ -4,16 +4,20 @@ import (
 	"bytes"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"testing"
+	"time"
 
+	"github.com/gin-gonic/gin"
+	"github.com/rrawrriw/angular-sauth-handler"
 	"gopkg.in/mgo.v2"
 )
 
 const (
-	AppNamePrefix    = "SJ"
-	TestSessionsColl = "Session"
-	TestDBURL        = "mongodb://127.0.0.1:27017"
-	TestDBName       = "testing-db"
+	AppNamePrefix   = "SJ"
+	TestDBURL       = "mongodb://127.0.0.1:27017"
+	TestDBName      = "testing-db"
+	TestDBDriverEnv = "SJ_TEST_DB_DRIVER"
 )
 
 type (
@@ -22,6 +26,15 @@ type (
 		Handler http.Handler
 		Header  http.Header
 	}
+
+	// TestEnv is the fixture of the handler tests, an app on a fresh test
+	// store and a router with the routes of APIRoutes at the root
+	TestEnv struct {
+		App     AppCtx
+		Store   Store
+		Handler http.Handler
+		t       *testing.T
+	}
 )
 
 func DialTestDB(t *testing.T) (*mgo.Session, *mgo.Database) {
@@ -45,6 +58,50 @@ func CleanTestDB(s *mgo.Session, db *mgo.Database, t *testing.T) {
 	s.Close()
 }
 
+// Without SJ_TEST_DB_DRIVER the tests run against the memory store and
+// then once more against SQLite, which needs no server. The driver mongo
+// runs them against TestDBURL only.
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if code == 0 && os.Getenv(TestDBDriverEnv) == "" {
+		os.Setenv(TestDBDriverEnv, SQLiteDriver)
+		code = m.Run()
+	}
+
+	os.Exit(code)
+}
+
+// Returns the store of the driver in SJ_TEST_DB_DRIVER, the memory store
+// if it is empty
+func NewTestStore(t *testing.T) Store {
+	switch os.Getenv(TestDBDriverEnv) {
+	case MongoDriver:
+		session, _ := DialTestDB(t)
+		return NewMgoStore(session, TestDBName)
+	case SQLiteDriver:
+		store, err := NewSQLiteStore(":memory:")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	default:
+		return NewMemStore()
+	}
+}
+
+func CleanTestStore(store Store, t *testing.T) {
+	s, ok := store.(MgoStore)
+	if ok {
+		CleanTestDB(s.Session, s.Session.DB(TestDBName), t)
+		return
+	}
+
+	err := store.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
 func (t *TestRequest) SendWithToken(method, path, token string) *httptest.ResponseRecorder {
 	reqData := *t
 	body := bytes.NewBufferString(reqData.Body)
@@ -68,3 +125,74 @@ func (t *TestRequest) Send(method, path string) *httptest.ResponseRecorder {
 	*t = reqData
 	return w
 }
+
+func (t *TestRequest) SendWithBearer(method, path, token string) *httptest.ResponseRecorder {
+	reqData := *t
+	body := bytes.NewBufferString(reqData.Body)
+	reqData.Header.Set("Authorization", "Bearer "+token)
+
+	req, _ := http.NewRequest(method, path, body)
+	req.Header = reqData.Header
+	w := httptest.NewRecorder()
+	reqData.Handler.ServeHTTP(w, req)
+	*t = reqData
+	return w
+}
+
+func NewTestEnv(t *testing.T) *TestEnv {
+	app := NewTestApp(t)
+	env := &TestEnv{
+		App:   app,
+		Store: app.Store(),
+		t:     t,
+	}
+	env.route()
+
+	return env
+}
+
+func (e *TestEnv) route() {
+	router := gin.New()
+	APIRoutes(router.Group(""), e.App)
+	e.Handler = router
+}
+
+// SetClock fixes AppCtx.Now of the handlers to now
+func (e *TestEnv) SetClock(now time.Time) {
+	e.App.Clock = func() time.Time {
+		return now
+	}
+	e.route()
+}
+
+func (e *TestEnv) Close() {
+	CleanTestStore(e.Store, e.t)
+}
+
+// NewUser creates a user who logs in with name and password
+func (e *TestEnv) NewUser(name, password string) User {
+	user := User{
+		Name: name,
+		Pass: NewTestPasswordHash(e.t, password),
+	}
+	id, err := e.Store.NewUser(user)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	user.Id = id
+
+	return user
+}
+
+func (e *TestEnv) NewSession(user User, token string) aauth.Session {
+	return NewTestSession(user.Id.Hex(), token, e.Store, e.t)
+}
+
+// Request returns a request with its own header, SendWithToken adds to it
+func (e *TestEnv) Request(body string) *TestRequest {
+	return &TestRequest{
+		Body:    body,
+		Header:  http.Header{},
+		Handler: e.Handler,
+	}
+}
@@ -0,0 +1,365 @@
+package sj
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Ops of a JournalEntry
+const (
+	NewSeriesOfUserOp    = "NewSeriesOfUser"
+	RemoveSeriesOfUserOp = "RemoveSeriesOfUser"
+	RemoveUserOp         = "RemoveUser"
+	RevokeUserOp         = "RevokeUser"
+	RevokeSessionsOp     = "RevokeSessions"
+
+	// Runs younger than JournalGrace may still be running in another
+	// instance, Recover leaves them alone.
+	JournalGrace = 10 * time.Minute
+)
+
+type (
+	// JournalEntry is written before the first step of a write which
+	// spans several documents and removed after the last one.
+	JournalEntry struct {
+		ID       bson.ObjectId `bson:"_id,omitempty"`
+		Op       string        `bson:"Op"`
+		UserID   bson.ObjectId `bson:"UserID"`
+		SeriesID bson.ObjectId `bson:"SeriesID"`
+		Created  time.Time     `bson:"Created"`
+	}
+
+	// Journal runs writes which span several documents. A failed run is
+	// rolled back or completed right away, if that fails too its entry
+	// stays in the journal until Recover handles it.
+	Journal struct {
+		Store Store
+	}
+)
+
+func NewJournal(store Store) Journal {
+	return Journal{
+		Store: store,
+	}
+}
+
+func (j Journal) begin(op string, userID, seriesID bson.ObjectId) (JournalEntry, error) {
+	entry := JournalEntry{
+		Op:       op,
+		UserID:   userID,
+		SeriesID: seriesID,
+		Created:  time.Now(),
+	}
+
+	id, err := j.Store.NewJournalEntry(entry)
+	if err != nil {
+		return JournalEntry{}, err
+	}
+	entry.ID = id
+
+	return entry, nil
+}
+
+// The writes are done, if the entry cannot be removed Recover finds a
+// completed run and only removes the entry.
+func (j Journal) end(entry JournalEntry) {
+	j.Store.RemoveJournalEntry(entry.ID)
+}
+
+// Creates the series and appends it to the series of the user
+func (j Journal) NewSeriesOfUser(userID bson.ObjectId, series Series) (bson.ObjectId, error) {
+	// The ID has to be known before the series exists
+	series.ID = bson.NewObjectId()
+	series.Owner = userID
+
+	entry, err := j.begin(NewSeriesOfUserOp, userID, series.ID)
+	if err != nil {
+		return bson.ObjectId(""), err
+	}
+
+	_, err = j.Store.NewSeries(series)
+	if err == nil {
+		change := ChangeUser{
+			Series: AppendIDItems{series.ID},
+		}
+		err = j.Store.UpdateUser(userID, change)
+	}
+
+	if err != nil {
+		rErr := j.Store.RemoveSeries(series.ID)
+		if rErr == nil || rErr == NotFoundError {
+			j.end(entry)
+		}
+
+		return bson.ObjectId(""), err
+	}
+
+	j.end(entry)
+
+	return series.ID, nil
+}
+
+// Removes the series of the user, see Store.RemoveSeriesOfUser
+func (j Journal) RemoveSeriesOfUser(userID, seriesID bson.ObjectId) error {
+	entry, err := j.begin(RemoveSeriesOfUserOp, userID, seriesID)
+	if err != nil {
+		return err
+	}
+
+	err = j.Store.RemoveSeriesOfUser(userID, seriesID)
+	if err != nil {
+		// A second try completes the first one
+		rErr := j.recover(entry)
+		if rErr != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	j.end(entry)
+
+	return nil
+}
+
+// Removes the user with his series links, watch records, sessions, API
+// tokens, TOTP and shares.
+// Series nobody else follows are removed too.
+func (j Journal) RemoveUser(userID bson.ObjectId) error {
+	entry, err := j.begin(RemoveUserOp, userID, bson.ObjectId(""))
+	if err != nil {
+		return err
+	}
+
+	err = j.removeUser(userID)
+	if err != nil {
+		// A second try completes the first one
+		rErr := j.recover(entry)
+		if rErr != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	j.end(entry)
+
+	return nil
+}
+
+// Every step can be repeated, the user goes last so an interrupted run
+// finds everything it still has to remove.
+func (j Journal) removeUser(userID bson.ObjectId) error {
+	user, err := j.Store.ReadUser(userID)
+	if err != nil {
+		return err
+	}
+
+	for _, seriesID := range user.Series {
+		err := j.Store.RemoveSeriesOfUser(userID, seriesID)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = j.revokeUser(userID)
+	if err != nil {
+		return err
+	}
+
+	granted, err := j.Store.ReadSharesOfOwner(userID)
+	if err != nil {
+		return err
+	}
+
+	received, err := j.Store.ReadSharesWithUser(userID)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range append(granted, received...) {
+		err := j.Store.RemoveShare(s.ID)
+		if err != nil && err != NotFoundError {
+			return err
+		}
+	}
+
+	err = j.Store.RemoveTOTP(userID)
+	if err != nil && err != NotFoundError {
+		return err
+	}
+
+	return j.Store.RemoveUser(userID)
+}
+
+// UpdateAndRevokeUser changes the user and removes all his sessions and
+// API tokens, like a password reset or a disabled account needs it.
+func (j Journal) UpdateAndRevokeUser(userID bson.ObjectId, change ChangeUser) error {
+	entry, err := j.begin(RevokeUserOp, userID, bson.ObjectId(""))
+	if err != nil {
+		return err
+	}
+
+	// Nothing changed yet
+	err = j.Store.UpdateUser(userID, change)
+	if err != nil {
+		j.end(entry)
+		return err
+	}
+
+	err = j.revokeUser(userID)
+	if err != nil {
+		// A second try completes the first one
+		rErr := j.recover(entry)
+		if rErr != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	j.end(entry)
+
+	return nil
+}
+
+// UpdateAndRevokeSessions changes the user and removes his sessions except
+// the one with the keep token. A recovered run removes all sessions.
+func (j Journal) UpdateAndRevokeSessions(userID bson.ObjectId, change ChangeUser, keep string) error {
+	entry, err := j.begin(RevokeSessionsOp, userID, bson.ObjectId(""))
+	if err != nil {
+		return err
+	}
+
+	// Nothing changed yet
+	err = j.Store.UpdateUser(userID, change)
+	if err != nil {
+		j.end(entry)
+		return err
+	}
+
+	err = RemoveSessionsOfUser(j.Store, userID.Hex(), keep)
+	if err != nil {
+		// A second try completes the first one
+		rErr := j.recover(entry)
+		if rErr != nil {
+			return err
+		}
+
+		return nil
+	}
+
+	j.end(entry)
+
+	return nil
+}
+
+func (j Journal) revokeUser(userID bson.ObjectId) error {
+	err := RemoveSessionsOfUser(j.Store, userID.Hex(), "")
+	if err != nil {
+		return err
+	}
+
+	tokens, err := j.Store.ReadAPITokensOfUser(userID)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range tokens {
+		err := j.Store.RemoveAPIToken(t.ID)
+		if err != nil && err != NotFoundError {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Recover rolls back or completes every run which was started before the
+// given time, it is run before the app serves requests. Other instances
+// may share the store, so the time has to be at least JournalGrace ago.
+func (j Journal) Recover(before time.Time) error {
+	entries, err := j.Store.ReadJournal()
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+	for _, entry := range entries {
+		if !entry.Created.Before(before) {
+			continue
+		}
+
+		err := j.recover(entry)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+// RecoverEvery runs Recover every interval until stop is closed. Runs which
+// were younger than JournalGrace at startup are recovered this way once
+// their instance had the time to finish them.
+func (j Journal) RecoverEvery(interval time.Duration, now func() time.Time, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			err := j.Recover(now().Add(-JournalGrace))
+			if err != nil {
+				log.Println(err)
+			}
+		}
+	}
+}
+
+func (j Journal) recover(entry JournalEntry) error {
+	var err error
+	switch entry.Op {
+	case NewSeriesOfUserOp:
+		err = j.recoverNewSeriesOfUser(entry)
+	case RemoveSeriesOfUserOp:
+		err = j.Store.RemoveSeriesOfUser(entry.UserID, entry.SeriesID)
+	case RemoveUserOp:
+		err = j.removeUser(entry.UserID)
+	case RevokeUserOp:
+		err = j.revokeUser(entry.UserID)
+	case RevokeSessionsOp:
+		err = RemoveSessionsOfUser(j.Store, entry.UserID.Hex(), "")
+	default:
+		m := fmt.Sprintf("Unknown journal op %v", entry.Op)
+		return errors.New(m)
+	}
+
+	// NotFoundError means there is nothing left to do
+	if err != nil && err != NotFoundError {
+		return err
+	}
+
+	return j.Store.RemoveJournalEntry(entry.ID)
+}
+
+// A series which made it into the series of the user is kept, otherwise
+// it is removed again.
+func (j Journal) recoverNewSeriesOfUser(entry JournalEntry) error {
+	user, err := j.Store.ReadUser(entry.UserID)
+	if err != nil && err != NotFoundError {
+		return err
+	}
+
+	if err == nil && ContainsID(user.Series, entry.SeriesID) {
+		return nil
+	}
+
+	return j.Store.RemoveSeries(entry.SeriesID)
+}
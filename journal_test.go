@@ -0,0 +1,261 @@
+package sj
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func Test_JournalRecover_OK(t *testing.T) {
+	store := NewTestStore(t)
+	defer CleanTestStore(store, t)
+
+	user, _, sList := NewTestDBEnv(t, store)
+
+	// Crashed after the series was created but before it was linked
+	orphan, err := store.NewSeries(Series{Title: "Elementary"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Crashed after the series was unlinked but before it was removed
+	change := ChangeUser{
+		Series: RemoveIDItems{sList[1].ID},
+	}
+	err = store.UpdateUser(user.Id, change)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	episode := Episode{
+		SeriesID: sList[1].ID,
+		Title:    "eps1.0_hellofriend.mov",
+		Session:  1,
+		Episode:  1,
+	}
+	_, err = store.NewEpisode(episode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := []JournalEntry{
+		{Op: NewSeriesOfUserOp, SeriesID: orphan},
+		{Op: NewSeriesOfUserOp, SeriesID: sList[0].ID},
+		{Op: RemoveSeriesOfUserOp, SeriesID: sList[1].ID},
+	}
+	for _, e := range entries {
+		e.UserID = user.Id
+		e.Created = time.Now()
+		_, err := store.NewJournalEntry(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = NewJournal(store).Recover(time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []bson.ObjectId{orphan, sList[1].ID} {
+		_, err := store.ReadSeries(id)
+		if err != NotFoundError {
+			t.Fatal("Expect", NotFoundError, "was", err)
+		}
+	}
+
+	_, err = store.ReadSeries(sList[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	episodes, err := store.ReadEpisodes(sList[1].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(episodes) != 0 {
+		t.Fatal("Expect no episodes was", episodes)
+	}
+
+	journal, err := store.ReadJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(journal) != 0 {
+		t.Fatal("Expect empty journal was", journal)
+	}
+}
+
+func Test_JournalRecover_KeepRunning(t *testing.T) {
+	store := NewTestStore(t)
+	defer CleanTestStore(store, t)
+
+	user, session, _ := NewTestDBEnv(t, store)
+
+	// Another instance is still running this one
+	now := time.Now()
+	running := JournalEntry{
+		Op:      RevokeSessionsOp,
+		UserID:  user.Id,
+		Created: now,
+	}
+	_, err := store.NewJournalEntry(running)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = NewJournal(store).Recover(now.Add(-JournalGrace))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.ReadSession(session.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Interrupted after the password changed
+	err = NewJournal(store).Recover(now.Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.ReadSession(session.Token)
+	if err != NotFoundError {
+		t.Fatal("Expect", NotFoundError, "was", err)
+	}
+
+	journal, err := store.ReadJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(journal) != 0 {
+		t.Fatal("Expect empty journal was", journal)
+	}
+}
+
+// The run is too young for the recovery at startup, a later sweep of
+// RecoverEvery finishes it
+func Test_JournalRecoverEvery_OK(t *testing.T) {
+	store := NewTestStore(t)
+	defer CleanTestStore(store, t)
+
+	user, session, _ := NewTestDBEnv(t, store)
+
+	start := time.Now()
+	running := JournalEntry{
+		Op:      RevokeSessionsOp,
+		UserID:  user.Id,
+		Created: start,
+	}
+	_, err := store.NewJournalEntry(running)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	journal := NewJournal(store)
+	err = journal.Recover(start.Add(-JournalGrace))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	later := func() time.Time {
+		return start.Add(JournalGrace + time.Second)
+	}
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		journal.RecoverEvery(10*time.Millisecond, later, stop)
+		close(done)
+	}()
+
+	entries := []JournalEntry{running}
+	for i := 0; i < 100 && len(entries) > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		entries, err = store.ReadJournal()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	close(stop)
+	<-done
+
+	if len(entries) != 0 {
+		t.Fatal("Expect empty journal was", entries)
+	}
+
+	_, err = store.ReadSession(session.Token)
+	if err != NotFoundError {
+		t.Fatal("Expect", NotFoundError, "was", err)
+	}
+}
+
+// Fails the next RemoveSession calls like a lost connection
+type failingSessionStore struct {
+	Store
+	fails int
+}
+
+func (s *failingSessionStore) RemoveSession(token string) error {
+	if s.fails > 0 {
+		s.fails--
+		return errors.New("Connection lost")
+	}
+
+	return s.Store.RemoveSession(token)
+}
+
+func Test_JournalUpdateAndRevokeSessions_Retry(t *testing.T) {
+	store := NewTestStore(t)
+	defer CleanTestStore(store, t)
+
+	user, session, _ := NewTestDBEnv(t, store)
+	other := NewTestSession(user.Id.Hex(), "other-token", store, t)
+
+	failing := &failingSessionStore{Store: store, fails: 1}
+	change := ChangeUser{Pass: NewTestPasswordHash(t, "secret")}
+	err := NewJournal(failing).UpdateAndRevokeSessions(user.Id, change, session.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The second try removes all sessions
+	for _, token := range []string{session.Token, other.Token} {
+		_, err := store.ReadSession(token)
+		if err != NotFoundError {
+			t.Fatal("Expect", NotFoundError, "was", err)
+		}
+	}
+
+	journal, err := store.ReadJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(journal) != 0 {
+		t.Fatal("Expect empty journal was", journal)
+	}
+
+	// Both tries fail, the entry stays for Recover
+	NewTestSession(user.Id.Hex(), "123", store, t)
+	failing.fails = 2
+	err = NewJournal(failing).UpdateAndRevokeSessions(user.Id, change, "")
+	if err == nil {
+		t.Fatal("Expect an error")
+	}
+
+	journal, err = store.ReadJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(journal) != 1 || journal[0].Op != RevokeSessionsOp {
+		t.Fatal("Expect a", RevokeSessionsOp, "entry was", journal)
+	}
+}
@@ -0,0 +1,895 @@
+package sj
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rrawrriw/angular-sauth-handler"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+type (
+	// MemStore keeps everything in memory. The collections are slices so
+	// that reads return documents in insertion order, like MongoDB does.
+	MemStore struct {
+		mutex    *sync.RWMutex
+		series   []Series
+		users    []User
+		episodes []Episode
+		watched  []WatchRecord
+		sessions []aauth.Session
+		tokens   []APIToken
+		totp     []TOTP
+		shares   []Share
+		journal  []JournalEntry
+	}
+)
+
+func NewMemStore() *MemStore {
+	return &MemStore{
+		mutex:    &sync.RWMutex{},
+		series:   []Series{},
+		users:    []User{},
+		episodes: []Episode{},
+		watched:  []WatchRecord{},
+		sessions: []aauth.Session{},
+	}
+}
+
+func (s *MemStore) Close() error {
+	return nil
+}
+
+func copyIDs(ids []bson.ObjectId) []bson.ObjectId {
+	if ids == nil {
+		return nil
+	}
+
+	c := make([]bson.ObjectId, len(ids))
+	copy(c, ids)
+
+	return c
+}
+
+func copySeries(series Series) Series {
+	series.Image = append(Resources{}, series.Image...)
+	series.Episodes = append(Resources{}, series.Episodes...)
+	series.Desc = append(Resources{}, series.Desc...)
+	series.Portal = append(Resources{}, series.Portal...)
+	return series
+}
+
+func copyUser(u User) User {
+	u.Series = copyIDs(u.Series)
+	return u
+}
+
+func (s *MemStore) seriesIndex(id bson.ObjectId) int {
+	for i, e := range s.series {
+		if e.ID == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (s *MemStore) userIndex(id bson.ObjectId) int {
+	for i, e := range s.users {
+		if e.Id == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (s *MemStore) userNameIndex(name string) int {
+	for i, e := range s.users {
+		if e.Name == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// Names are unique regardless of case
+func (s *MemStore) userNameFoldIndex(name string) int {
+	for i, e := range s.users {
+		if strings.EqualFold(e.Name, name) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (s *MemStore) episodeIndex(id bson.ObjectId) int {
+	for i, e := range s.episodes {
+		if e.ID == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (s *MemStore) watchRecordIndex(userID, episodeID bson.ObjectId) int {
+	for i, e := range s.watched {
+		if e.UserID == userID && e.EpisodeID == episodeID {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (s *MemStore) sessionIndex(token string) int {
+	for i, e := range s.sessions {
+		if e.Token == token {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (s *MemStore) NewSeries(series Series) (bson.ObjectId, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	id := series.ID
+	if id == "" {
+		id = bson.NewObjectId()
+	}
+
+	if s.seriesIndex(id) != -1 {
+		return bson.ObjectId(""), errors.New("Series exists")
+	}
+
+	series = copySeries(NormalizeSeries(series))
+	series.ID = id
+	s.series = append(s.series, series)
+
+	return id, nil
+}
+
+func (s *MemStore) ReadSeries(id bson.ObjectId) (Series, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	i := s.seriesIndex(id)
+	if i == -1 {
+		return Series{}, NotFoundError
+	}
+
+	return copySeries(s.series[i]), nil
+}
+
+func (s *MemStore) ReadAllSeries(ids []bson.ObjectId) ([]Series, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return s.readAllSeries(ids), nil
+}
+
+func (s *MemStore) readAllSeries(ids []bson.ObjectId) SeriesList {
+	resultList := SeriesList{}
+	for _, e := range s.series {
+		if ContainsID(ids, e.ID) {
+			resultList = append(resultList, copySeries(e))
+		}
+	}
+	sort.Sort(resultList)
+
+	return resultList
+}
+
+func (s *MemStore) UpdateSeries(id bson.ObjectId, change ChangeSeries) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	i := s.seriesIndex(id)
+	if i == -1 {
+		return NotFoundError
+	}
+
+	series := s.series[i]
+
+	if change.Title != "" {
+		series.Title = change.Title
+	}
+
+	if change.Order != "" {
+		series.Order = change.Order
+	}
+
+	series.Image = ApplyResourceChange(series.Image, change.Image)
+	series.Desc = ApplyResourceChange(series.Desc, change.Desc)
+	series.Episodes = ApplyResourceChange(series.Episodes, change.Episodes)
+	series.Portal = ApplyResourceChange(series.Portal, change.Portal)
+
+	s.series[i] = series
+
+	return nil
+}
+
+func (s *MemStore) RemoveSeries(id bson.ObjectId) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	i := s.seriesIndex(id)
+	if i == -1 {
+		return NotFoundError
+	}
+
+	ids := []bson.ObjectId{id}
+	for i, u := range s.users {
+		s.users[i].Series = removeIDs(u.Series, ids)
+	}
+
+	s.removeSeriesData(id)
+
+	return nil
+}
+
+func removeIDs(l []bson.ObjectId, ids []bson.ObjectId) []bson.ObjectId {
+	result := []bson.ObjectId{}
+	for _, e := range l {
+		if !ContainsID(ids, e) {
+			result = append(result, e)
+		}
+	}
+
+	return result
+}
+
+// Expects the write lock
+func (s *MemStore) removeSeriesData(id bson.ObjectId) {
+	episodes := []Episode{}
+	for _, e := range s.episodes {
+		if e.SeriesID != id {
+			episodes = append(episodes, e)
+		}
+	}
+	s.episodes = episodes
+
+	watched := []WatchRecord{}
+	for _, r := range s.watched {
+		if r.SeriesID != id {
+			watched = append(watched, r)
+		}
+	}
+	s.watched = watched
+
+	i := s.seriesIndex(id)
+	if i != -1 {
+		s.series = append(s.series[:i], s.series[i+1:]...)
+	}
+}
+
+func (s *MemStore) RemoveSeriesOfUser(userID, seriesID bson.ObjectId) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	i := s.userIndex(userID)
+	if i == -1 {
+		return NotFoundError
+	}
+	s.users[i].Series = removeIDs(s.users[i].Series, []bson.ObjectId{seriesID})
+
+	watched := []WatchRecord{}
+	for _, r := range s.watched {
+		if r.UserID != userID || r.SeriesID != seriesID {
+			watched = append(watched, r)
+		}
+	}
+	s.watched = watched
+
+	for _, u := range s.users {
+		if ContainsID(u.Series, seriesID) {
+			return nil
+		}
+	}
+
+	s.removeSeriesData(seriesID)
+
+	return nil
+}
+
+func (s *MemStore) NewUser(user User) (bson.ObjectId, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.userNameFoldIndex(user.Name) != -1 {
+		return bson.ObjectId(""), UserExistsError
+	}
+
+	id := bson.NewObjectId()
+	newUser := User{
+		Id:       id,
+		Name:     user.Name,
+		Pass:     user.Pass,
+		Series:   copyIDs(user.Series),
+		Role:     user.Role,
+		Disabled: user.Disabled,
+	}
+	s.users = append(s.users, newUser)
+
+	return id, nil
+}
+
+func (s *MemStore) ReadUser(id bson.ObjectId) (User, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	i := s.userIndex(id)
+	if i == -1 {
+		return User{}, NotFoundError
+	}
+
+	return copyUser(s.users[i]), nil
+}
+
+func (s *MemStore) FindUser(name string) (User, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	i := s.userNameIndex(name)
+	if i == -1 {
+		return User{}, NotFoundError
+	}
+
+	return copyUser(s.users[i]), nil
+}
+
+func (s *MemStore) ReadUsers() ([]User, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	users := []User{}
+	for _, u := range s.users {
+		users = append(users, copyUser(u))
+	}
+	sort.Sort(usersByName(users))
+
+	return users, nil
+}
+
+func (s *MemStore) ReadSeriesOfUser(id bson.ObjectId) ([]Series, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	i := s.userIndex(id)
+	if i == -1 {
+		return []Series{}, NotFoundError
+	}
+
+	return s.readAllSeries(s.users[i].Series), nil
+}
+
+// UpdateUser mirrors the MongoDB update: AppendIDItems behaves like $push
+// (duplicates are kept), RemoveIDItems like $pull with $in (every
+// occurrence is removed) and a plain []bson.ObjectId replaces the list.
+func (s *MemStore) UpdateUser(id bson.ObjectId, change ChangeUser) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	i := s.userIndex(id)
+	if i == -1 {
+		return NotFoundError
+	}
+
+	user := copyUser(s.users[i])
+
+	if change.Name != "" {
+		j := s.userNameFoldIndex(change.Name)
+		if j != -1 && j != i {
+			return UserExistsError
+		}
+		user.Name = change.Name
+	}
+
+	if change.Pass != "" {
+		user.Pass = change.Pass
+	}
+
+	if change.Role != "" {
+		user.Role = change.Role
+	}
+
+	if change.Disabled != nil {
+		user.Disabled = *change.Disabled
+	}
+
+	switch items := change.Series.(type) {
+	case AppendIDItems:
+		user.Series = append(user.Series, items...)
+	case RemoveIDItems:
+		user.Series = removeIDs(user.Series, items)
+	case []bson.ObjectId:
+		user.Series = copyIDs(items)
+	}
+
+	s.users[i] = user
+
+	return nil
+}
+
+func (s *MemStore) RemoveUser(id bson.ObjectId) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	i := s.userIndex(id)
+	if i == -1 {
+		return NotFoundError
+	}
+
+	s.users = append(s.users[:i], s.users[i+1:]...)
+
+	return nil
+}
+
+func (s *MemStore) NewEpisode(episode Episode) (bson.ObjectId, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	id := bson.NewObjectId()
+	episode.ID = id
+	s.episodes = append(s.episodes, episode)
+
+	return id, nil
+}
+
+func (s *MemStore) NewEpisodeBatch(episodes []Episode) ([]bson.ObjectId, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	ids := []bson.ObjectId{}
+	for _, e := range episodes {
+		id := bson.NewObjectId()
+		e.ID = id
+		ids = append(ids, id)
+		s.episodes = append(s.episodes, e)
+	}
+
+	return ids, nil
+}
+
+func (s *MemStore) ReadEpisode(id bson.ObjectId) (Episode, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	i := s.episodeIndex(id)
+	if i == -1 {
+		return Episode{}, NotFoundError
+	}
+
+	return s.episodes[i], nil
+}
+
+func (s *MemStore) ReadEpisodes(seriesID bson.ObjectId) ([]Episode, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	result := []Episode{}
+	for _, e := range s.episodes {
+		if e.SeriesID == seriesID {
+			result = append(result, e)
+		}
+	}
+
+	return result, nil
+}
+
+func (s *MemStore) WatchEpisode(userID, id bson.ObjectId) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	i := s.episodeIndex(id)
+	if i == -1 {
+		return NotFoundError
+	}
+
+	record := WatchRecord{
+		UserID:    userID,
+		SeriesID:  s.episodes[i].SeriesID,
+		EpisodeID: id,
+		Watched:   time.Now(),
+	}
+
+	j := s.watchRecordIndex(userID, id)
+	if j == -1 {
+		record.ID = bson.NewObjectId()
+		s.watched = append(s.watched, record)
+		return nil
+	}
+
+	record.ID = s.watched[j].ID
+	s.watched[j] = record
+
+	return nil
+}
+
+func (s *MemStore) UnwatchEpisode(userID, id bson.ObjectId) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	i := s.watchRecordIndex(userID, id)
+	if i == -1 {
+		return NotFoundError
+	}
+
+	s.watched = append(s.watched[:i], s.watched[i+1:]...)
+
+	return nil
+}
+
+func (s *MemStore) ReadWatchedEpisodes(userID, seriesID bson.ObjectId) (Episodes, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	result := Episodes{}
+	for _, r := range s.watched {
+		if r.UserID != userID || r.SeriesID != seriesID {
+			continue
+		}
+
+		i := s.episodeIndex(r.EpisodeID)
+		if i == -1 {
+			continue
+		}
+		result = append(result, s.episodes[i])
+	}
+
+	sort.Sort(result)
+
+	return result, nil
+}
+
+func (s *MemStore) ReadEpisodeStates(userID bson.ObjectId) ([]EpisodeState, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	i := s.userIndex(userID)
+	if i == -1 {
+		return []EpisodeState{}, nil
+	}
+
+	result := []EpisodeState{}
+	for _, e := range s.episodes {
+		if !ContainsID(s.users[i].Series, e.SeriesID) {
+			continue
+		}
+
+		state := EpisodeState{
+			Episode: e,
+		}
+		j := s.watchRecordIndex(userID, e.ID)
+		if j != -1 {
+			state.Watched = s.watched[j].Watched
+		}
+		result = append(result, state)
+	}
+
+	return result, nil
+}
+
+func (s *MemStore) NewSession(session aauth.Session) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.sessions = append(s.sessions, session)
+
+	return nil
+}
+
+func (s *MemStore) ReadSession(token string) (aauth.Session, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	i := s.sessionIndex(token)
+	if i == -1 {
+		return aauth.Session{}, NotFoundError
+	}
+
+	return s.sessions[i], nil
+}
+
+func (s *MemStore) ReadSessionsOfUser(userID string) ([]aauth.Session, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	sessions := []aauth.Session{}
+	for _, e := range s.sessions {
+		if e.UserID == userID {
+			sessions = append(sessions, e)
+		}
+	}
+
+	return sessions, nil
+}
+
+func (s *MemStore) RemoveSession(token string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	i := s.sessionIndex(token)
+	if i == -1 {
+		return NotFoundError
+	}
+
+	s.sessions = append(s.sessions[:i], s.sessions[i+1:]...)
+
+	return nil
+}
+
+func (s *MemStore) NewJournalEntry(entry JournalEntry) (bson.ObjectId, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	id := bson.NewObjectId()
+	entry.ID = id
+	s.journal = append(s.journal, entry)
+
+	return id, nil
+}
+
+func (s *MemStore) ReadJournal() ([]JournalEntry, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	return append([]JournalEntry{}, s.journal...), nil
+}
+
+func (s *MemStore) RemoveJournalEntry(id bson.ObjectId) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, e := range s.journal {
+		if e.ID == id {
+			s.journal = append(s.journal[:i], s.journal[i+1:]...)
+			return nil
+		}
+	}
+
+	return NotFoundError
+}
+
+func (s *MemStore) NewAPIToken(token APIToken) (bson.ObjectId, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, e := range s.tokens {
+		if e.Hash == token.Hash {
+			return bson.ObjectId(""), errors.New("Token exists")
+		}
+	}
+
+	id := bson.NewObjectId()
+	token.ID = id
+	s.tokens = append(s.tokens, token)
+
+	return id, nil
+}
+
+func (s *MemStore) ReadAPIToken(hash string) (APIToken, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, e := range s.tokens {
+		if e.Hash == hash {
+			return e, nil
+		}
+	}
+
+	return APIToken{}, NotFoundError
+}
+
+func (s *MemStore) ReadAPITokensOfUser(userID bson.ObjectId) ([]APIToken, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	tokens := []APIToken{}
+	for _, e := range s.tokens {
+		if e.UserID == userID {
+			tokens = append(tokens, e)
+		}
+	}
+
+	return tokens, nil
+}
+
+func (s *MemStore) RemoveAPIToken(id bson.ObjectId) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, e := range s.tokens {
+		if e.ID == id {
+			s.tokens = append(s.tokens[:i], s.tokens[i+1:]...)
+			return nil
+		}
+	}
+
+	return NotFoundError
+}
+
+func copyTOTP(t TOTP) TOTP {
+	codes := make([]string, len(t.RecoveryCodes))
+	copy(codes, t.RecoveryCodes)
+	t.RecoveryCodes = codes
+
+	return t
+}
+
+func (s *MemStore) ReadTOTP(userID bson.ObjectId) (TOTP, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, e := range s.totp {
+		if e.UserID == userID {
+			return copyTOTP(e), nil
+		}
+	}
+
+	return TOTP{}, NotFoundError
+}
+
+func (s *MemStore) SaveTOTP(totp TOTP) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, e := range s.totp {
+		if e.UserID == totp.UserID {
+			s.totp[i] = copyTOTP(totp)
+			return nil
+		}
+	}
+
+	s.totp = append(s.totp, copyTOTP(totp))
+
+	return nil
+}
+
+func (s *MemStore) UseTOTPStep(userID bson.ObjectId, step int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, e := range s.totp {
+		if e.UserID == userID && e.LastStep < step {
+			s.totp[i].LastStep = step
+			s.totp[i].Failures = 0
+			return nil
+		}
+	}
+
+	return NotFoundError
+}
+
+func (s *MemStore) UseRecoveryCode(userID bson.ObjectId, hash string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, e := range s.totp {
+		if e.UserID != userID {
+			continue
+		}
+
+		for j, c := range e.RecoveryCodes {
+			if c == hash {
+				codes := append([]string{}, e.RecoveryCodes[:j]...)
+				s.totp[i].RecoveryCodes = append(codes, e.RecoveryCodes[j+1:]...)
+				s.totp[i].Failures = 0
+				return nil
+			}
+		}
+	}
+
+	return NotFoundError
+}
+
+func (s *MemStore) FailTOTP(userID bson.ObjectId, now time.Time) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, e := range s.totp {
+		if e.UserID == userID {
+			s.totp[i].Failures++
+			s.totp[i].LastFailure = now
+			return nil
+		}
+	}
+
+	return NotFoundError
+}
+
+func (s *MemStore) RemoveTOTP(userID bson.ObjectId) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, e := range s.totp {
+		if e.UserID == userID {
+			s.totp = append(s.totp[:i], s.totp[i+1:]...)
+			return nil
+		}
+	}
+
+	return NotFoundError
+}
+
+func (s *MemStore) NewShare(share Share) (bson.ObjectId, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, e := range s.shares {
+		if e.OwnerID == share.OwnerID && e.UserID == share.UserID {
+			return bson.ObjectId(""), ShareExistsError
+		}
+	}
+
+	id := bson.NewObjectId()
+	share.ID = id
+	s.shares = append(s.shares, share)
+
+	return id, nil
+}
+
+func (s *MemStore) ReadShare(ownerID, userID bson.ObjectId) (Share, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, e := range s.shares {
+		if e.OwnerID == ownerID && e.UserID == userID {
+			return e, nil
+		}
+	}
+
+	return Share{}, NotFoundError
+}
+
+func (s *MemStore) ReadSharesOfOwner(ownerID bson.ObjectId) ([]Share, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	shares := []Share{}
+	for _, e := range s.shares {
+		if e.OwnerID == ownerID {
+			shares = append(shares, e)
+		}
+	}
+
+	return shares, nil
+}
+
+func (s *MemStore) ReadSharesWithUser(userID bson.ObjectId) ([]Share, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	shares := []Share{}
+	for _, e := range s.shares {
+		if e.UserID == userID {
+			shares = append(shares, e)
+		}
+	}
+
+	return shares, nil
+}
+
+func (s *MemStore) RemoveShare(id bson.ObjectId) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for i, e := range s.shares {
+		if e.ID == id {
+			s.shares = append(s.shares[:i], s.shares[i+1:]...)
+			return nil
+		}
+	}
+
+	return NotFoundError
+}
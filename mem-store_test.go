@@ -0,0 +1,79 @@
+package sj
+
+import (
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func Test_MemStoreUpdateUser_PushPull_OK(t *testing.T) {
+	store := NewMemStore()
+
+	sID1 := bson.NewObjectId()
+	sID2 := bson.NewObjectId()
+
+	user := User{
+		Name: "Nase",
+		Pass: "Loch",
+		Series: []bson.ObjectId{
+			sID1,
+		},
+	}
+
+	uID, err := store.NewUser(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// $push keeps duplicates
+	change := ChangeUser{
+		Series: AppendIDItems{
+			sID2,
+			sID1,
+		},
+	}
+	err = store.UpdateUser(uID, change)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := store.ReadUser(uID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []bson.ObjectId{sID1, sID2, sID1}
+	if len(result.Series) != len(expect) {
+		t.Fatal("Expect", expect, "was", result.Series)
+	}
+	for i, id := range expect {
+		if result.Series[i] != id {
+			t.Fatal("Expect", expect, "was", result.Series)
+		}
+	}
+
+	// $pull removes every occurrence
+	change = ChangeUser{
+		Series: RemoveIDItems{
+			sID1,
+		},
+	}
+	err = store.UpdateUser(uID, change)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err = store.ReadUser(uID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Series) != 1 || result.Series[0] != sID2 {
+		t.Fatal("Expect", []bson.ObjectId{sID2}, "was", result.Series)
+	}
+
+	err = store.UpdateUser(bson.NewObjectId(), change)
+	if err != NotFoundError {
+		t.Fatal("Expect", NotFoundError, "was", err)
+	}
+}
@@ -0,0 +1,291 @@
+package sj
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	MigrationColl = "Migrations"
+)
+
+type (
+	// MgoMigration is the MongoDB counterpart of SQLMigration. MongoDB has
+	// no transactions, so Migrate must be safe to run again when it failed
+	// half way.
+	MgoMigration struct {
+		Version int
+		Migrate func(*mgo.Database) error
+	}
+
+	migrationDoc struct {
+		Version int       `bson:"_id"`
+		Applied time.Time `bson:"Applied"`
+	}
+)
+
+var MgoMigrations = []MgoMigration{
+	{
+		Version: 1,
+		Migrate: migrateWatchRecords,
+	},
+	{
+		Version: 2,
+		Migrate: migrateResourceLists,
+	},
+	{
+		Version: 3,
+		Migrate: migrateUniqueUserName,
+	},
+	{
+		Version: 4,
+		Migrate: migrateAPITokenIndex,
+	},
+	{
+		Version: 5,
+		Migrate: migrateShareIndex,
+	},
+	{
+		Version: 6,
+		Migrate: migrateSeriesOwner,
+	},
+	{
+		Version: 7,
+		Migrate: migrateUserNameCase,
+	},
+}
+
+func MigrateMgo(db *mgo.Database, migrations []MgoMigration) error {
+	coll := db.C(MigrationColl)
+
+	for _, m := range migrations {
+		n, err := coll.FindId(m.Version).Count()
+		if err != nil {
+			return err
+		}
+
+		if n > 0 {
+			continue
+		}
+
+		err = m.Migrate(db)
+		if err != nil {
+			return err
+		}
+
+		doc := migrationDoc{
+			Version: m.Version,
+			Applied: time.Now(),
+		}
+		err = coll.Insert(doc)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Moves the old global Episode.Watched flag into WatchRecords. The flag was
+// visible to every user following the series, so every one of them gets a
+// record.
+func migrateWatchRecords(db *mgo.Database) error {
+	records := db.C(WatchRecordColl)
+
+	index := mgo.Index{
+		Key:    []string{"UserID", "EpisodeID"},
+		Unique: true,
+	}
+	err := records.EnsureIndex(index)
+	if err != nil {
+		return err
+	}
+
+	episodes := []Episode{}
+	err = db.C(EpisodeColl).Find(bson.M{"Watched": true}).All(&episodes)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, e := range episodes {
+		users := []User{}
+		err := db.C(UserColl).Find(bson.M{"Series": e.SeriesID}).All(&users)
+		if err != nil {
+			return err
+		}
+
+		for _, u := range users {
+			selector := bson.M{
+				"UserID":    u.Id,
+				"EpisodeID": e.ID,
+			}
+			update := bson.M{
+				"$set": bson.M{
+					"SeriesID": e.SeriesID,
+					"Watched":  now,
+				},
+			}
+			_, err := records.Upsert(selector, update)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	selector := bson.M{
+		"Watched": bson.M{
+			"$exists": true,
+		},
+	}
+	update := bson.M{
+		"$unset": bson.M{
+			"Watched": "",
+		},
+	}
+	_, err = db.C(EpisodeColl).UpdateAll(selector, update)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Series stored a single Resource per field before, every field becomes a
+// list. Empty resources are dropped instead of being wrapped.
+func migrateResourceLists(db *mgo.Database) error {
+	coll := db.C(SeriesColl)
+	fields := []string{"Image", "Episodes", "Desc", "Portal"}
+
+	doc := bson.M{}
+	iter := coll.Find(nil).Iter()
+	for iter.Next(&doc) {
+		set := bson.M{}
+		for _, field := range fields {
+			switch v := doc[field].(type) {
+			case bson.M:
+				r := Resource{}
+				r.Name, _ = v["Name"].(string)
+				r.URL, _ = v["URL"].(string)
+
+				if ResourceEmpty(r) {
+					set[field] = Resources{}
+				} else {
+					set[field] = Resources{r}
+				}
+			case nil:
+				set[field] = Resources{}
+			}
+		}
+
+		if len(set) > 0 {
+			err := coll.UpdateId(doc["_id"], bson.M{"$set": set})
+			if err != nil {
+				iter.Close()
+				return err
+			}
+		}
+
+		doc = bson.M{}
+	}
+
+	return iter.Close()
+}
+
+// Fails as long as two users share a name, these have to be renamed by
+// hand before.
+func migrateUniqueUserName(db *mgo.Database) error {
+	index := mgo.Index{
+		Key:    []string{"Name"},
+		Unique: true,
+	}
+
+	return db.C(UserColl).EnsureIndex(index)
+}
+
+func migrateAPITokenIndex(db *mgo.Database) error {
+	index := mgo.Index{
+		Key:    []string{"Hash"},
+		Unique: true,
+	}
+
+	return db.C(APITokenColl).EnsureIndex(index)
+}
+
+func migrateShareIndex(db *mgo.Database) error {
+	index := mgo.Index{
+		Key:    []string{"OwnerID", "UserID"},
+		Unique: true,
+	}
+
+	err := db.C(ShareColl).EnsureIndex(index)
+	if err != nil {
+		return err
+	}
+
+	return db.C(ShareColl).EnsureIndexKey("UserID")
+}
+
+// The IDs start with the creation time, the first user who followed a
+// series most likely created it. Series with an owner are skipped, so a
+// second run keeps the owners of the first one.
+func migrateSeriesOwner(db *mgo.Database) error {
+	iter := db.C(UserColl).Find(nil).Sort("_id").Iter()
+
+	user := User{}
+	for iter.Next(&user) {
+		selector := bson.M{
+			"_id":   bson.M{"$in": user.Series},
+			"Owner": bson.M{"$exists": false},
+		}
+		update := bson.M{
+			"$set": bson.M{"Owner": user.Id},
+		}
+		_, err := db.C(SeriesColl).UpdateAll(selector, update)
+		if err != nil {
+			iter.Close()
+			return err
+		}
+
+		user = User{}
+	}
+
+	return iter.Close()
+}
+
+// Replaces the unique index of migrateUniqueUserName by one which ignores
+// the case. Fails as long as two names differ only in case, these have to
+// be renamed by hand before.
+func migrateUserNameCase(db *mgo.Database) error {
+	coll := db.C(UserColl)
+
+	index := mgo.Index{
+		Key:    []string{"Name"},
+		Name:   "Name_nocase",
+		Unique: true,
+		Collation: &mgo.Collation{
+			Locale:   "en",
+			Strength: 2,
+		},
+	}
+	err := coll.EnsureIndex(index)
+	if err != nil {
+		return err
+	}
+
+	indexes, err := coll.Indexes()
+	if err != nil {
+		return err
+	}
+
+	// Already dropped by an earlier run
+	for _, i := range indexes {
+		if i.Name == "Name_1" {
+			return coll.DropIndexName(i.Name)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package sj
+
+import (
+	"sort"
+	"strings"
+)
+
+// Orders of the episodes of a series, see Series.Order
+const (
+	SeasonOrder   = "season"
+	AbsoluteOrder = "absolute"
+	AiredOrder    = "aired"
+)
+
+type (
+	// EpisodeCompare is negative if a comes before b, positive if b comes
+	// before a and 0 only for the same episode. Every EpisodeCompare
+	// compares keys one after the other, so "comes before" is a strict
+	// weak ordering like sort.Interface expects.
+	EpisodeCompare func(a, b Episode) int
+
+	episodesByOrder struct {
+		Episodes
+		compare EpisodeCompare
+	}
+)
+
+func (l episodesByOrder) Less(x, y int) bool {
+	return l.compare(l.Episodes[x], l.Episodes[y]) < 0
+}
+
+// Special episodes are in season 0
+func (e Episode) Special() bool {
+	return e.Session == 0
+}
+
+// ValidOrder accepts the orders and the empty order of older series
+func ValidOrder(order string) bool {
+	switch order {
+	case "", SeasonOrder, AbsoluteOrder, AiredOrder:
+		return true
+	}
+
+	return false
+}
+
+func compareInt(a, b int) int {
+	if a < b {
+		return -1
+	}
+
+	if a > b {
+		return 1
+	}
+
+	return 0
+}
+
+// Known values come first
+func compareKnown(a, b bool) int {
+	if a == b {
+		return 0
+	}
+
+	if a {
+		return -1
+	}
+
+	return 1
+}
+
+// CompareSeason orders by season, episode and part. Specials of season 0
+// come after the regular seasons, the ID keeps equal numbers apart.
+func CompareSeason(a, b Episode) int {
+	if c := compareKnown(!a.Special(), !b.Special()); c != 0 {
+		return c
+	}
+
+	if c := compareInt(a.Session, b.Session); c != 0 {
+		return c
+	}
+
+	if c := compareInt(a.Episode, b.Episode); c != 0 {
+		return c
+	}
+
+	if c := compareInt(a.Part, b.Part); c != 0 {
+		return c
+	}
+
+	return strings.Compare(string(a.ID), string(b.ID))
+}
+
+// CompareAbsolute orders by the absolute number like anime are counted,
+// episodes without one follow in the season order.
+func CompareAbsolute(a, b Episode) int {
+	if c := compareKnown(a.Absolute > 0, b.Absolute > 0); c != 0 {
+		return c
+	}
+
+	if c := compareInt(a.Absolute, b.Absolute); c != 0 {
+		return c
+	}
+
+	if c := compareInt(a.Part, b.Part); c != 0 {
+		return c
+	}
+
+	return CompareSeason(a, b)
+}
+
+// CompareAired orders by the air date, episodes of the same day and
+// episodes without a date follow in the season order.
+func CompareAired(a, b Episode) int {
+	if c := compareKnown(!a.Aired.IsZero(), !b.Aired.IsZero()); c != 0 {
+		return c
+	}
+
+	if a.Aired.Before(b.Aired) {
+		return -1
+	}
+
+	if a.Aired.After(b.Aired) {
+		return 1
+	}
+
+	return CompareSeason(a, b)
+}
+
+// EpisodeOrder returns the comparison of the order, the season order if
+// the order is empty or unknown.
+func EpisodeOrder(order string) EpisodeCompare {
+	switch order {
+	case AbsoluteOrder:
+		return CompareAbsolute
+	case AiredOrder:
+		return CompareAired
+	}
+
+	return CompareSeason
+}
+
+func SortEpisodes(episodes Episodes, order string) {
+	sort.Sort(episodesByOrder{episodes, EpisodeOrder(order)})
+}
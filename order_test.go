@@ -0,0 +1,108 @@
+package sj
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func NewTestEpisodes() Episodes {
+	day := func(d int) time.Time {
+		return time.Date(2015, time.August, d, 0, 0, 0, 0, time.UTC)
+	}
+
+	return Episodes{
+		{ID: bson.NewObjectId(), Title: "S1E2", Session: 1, Episode: 2, Absolute: 2, Aired: day(8)},
+		{ID: bson.NewObjectId(), Title: "Special", Session: 0, Episode: 1, Aired: day(5)},
+		{ID: bson.NewObjectId(), Title: "S2E1", Session: 2, Episode: 1, Absolute: 4},
+		{ID: bson.NewObjectId(), Title: "S1E3.2", Session: 1, Episode: 3, Part: 2, Absolute: 3, Aired: day(15)},
+		{ID: bson.NewObjectId(), Title: "S1E3.1", Session: 1, Episode: 3, Part: 1, Absolute: 3, Aired: day(15)},
+		{ID: bson.NewObjectId(), Title: "S1E1", Session: 1, Episode: 1, Absolute: 1, Aired: day(1)},
+	}
+}
+
+func EpisodeTitles(episodes Episodes) []string {
+	titles := []string{}
+	for _, e := range episodes {
+		titles = append(titles, e.Title)
+	}
+
+	return titles
+}
+
+func Test_SortEpisodes_OK(t *testing.T) {
+	cases := map[string][]string{
+		SeasonOrder:   {"S1E1", "S1E2", "S1E3.1", "S1E3.2", "S2E1", "Special"},
+		AbsoluteOrder: {"S1E1", "S1E2", "S1E3.1", "S1E3.2", "S2E1", "Special"},
+		AiredOrder:    {"S1E1", "Special", "S1E2", "S1E3.1", "S1E3.2", "S2E1"},
+		"":            {"S1E1", "S1E2", "S1E3.1", "S1E3.2", "S2E1", "Special"},
+	}
+
+	for order, expect := range cases {
+		episodes := NewTestEpisodes()
+		SortEpisodes(episodes, order)
+
+		titles := EpisodeTitles(episodes)
+		for i := range expect {
+			if titles[i] != expect[i] {
+				t.Fatal("Expect", expect, "in the", order, "order was", titles)
+			}
+		}
+	}
+}
+
+// Same season, the old Less compared the episode with the season
+func Test_EpisodesLess_OK(t *testing.T) {
+	episodes := Episodes{
+		{ID: bson.NewObjectId(), Title: "S2E3", Session: 2, Episode: 3},
+		{ID: bson.NewObjectId(), Title: "S2E1", Session: 2, Episode: 1},
+		{ID: bson.NewObjectId(), Title: "S2E2", Session: 2, Episode: 2},
+	}
+
+	if episodes.Less(0, 0) {
+		t.Fatal("Expect an episode not to come before itself")
+	}
+
+	if !episodes.Less(1, 2) || episodes.Less(2, 1) {
+		t.Fatal("Expect S2E1 before S2E2")
+	}
+}
+
+// Checks the rules of a strict weak ordering for every triple
+func Test_EpisodeOrder_StrictWeakOrdering(t *testing.T) {
+	episodes := NewTestEpisodes()
+	// Equal numbers are kept apart by the ID
+	episodes = append(episodes, Episode{ID: bson.NewObjectId(), Title: "S1E1", Session: 1, Episode: 1})
+
+	for _, order := range []string{SeasonOrder, AbsoluteOrder, AiredOrder} {
+		less := func(a, b Episode) bool {
+			return EpisodeOrder(order)(a, b) < 0
+		}
+		equiv := func(a, b Episode) bool {
+			return !less(a, b) && !less(b, a)
+		}
+
+		for _, a := range episodes {
+			if less(a, a) {
+				t.Fatal("Expect irreflexive", order, a)
+			}
+
+			for _, b := range episodes {
+				if less(a, b) && less(b, a) {
+					t.Fatal("Expect asymmetric", order, a, b)
+				}
+
+				for _, c := range episodes {
+					if less(a, b) && less(b, c) && !less(a, c) {
+						t.Fatal("Expect transitive", order, a, b, c)
+					}
+
+					if equiv(a, b) && equiv(b, c) && !equiv(a, c) {
+						t.Fatal("Expect transitive equivalence", order, a, b, c)
+					}
+				}
+			}
+		}
+	}
+}
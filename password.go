@@ -0,0 +1,278 @@
+package sj
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rrawrriw/angular-sauth-handler"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	Argon2idHash = "argon2id"
+	BcryptHash   = "bcrypt"
+)
+
+var (
+	UnknownHashError = errors.New("Unknown password hash")
+
+	// Hashes of a random password, logins of unknown users verify against
+	// them to take as long as the logins of known users
+	dummyHashes = []string{
+		"$argon2id$v=19$m=65536,t=1,p=4$ebQFz1WKhKh78oj20k5Emw$BW0NxWQL8TtdZRCC1kER8FtvqKzczE1FxcNnF/HUyeI",
+		"$2a$10$pEgNJ9mVrzWelFS63l8GC.ywG2zU9u7CsekgFkdcpChxMdZVpAEoO",
+	}
+
+	DefaultArgon2idHasher = Argon2idHasher{
+		Time:    1,
+		Memory:  64 * 1024,
+		Threads: 4,
+		KeyLen:  32,
+		SaltLen: 16,
+	}
+
+	DefaultBcryptHasher = BcryptHasher{
+		Cost: bcrypt.DefaultCost,
+	}
+)
+
+type (
+	// PasswordHasher hashes passwords into strings which start with a
+	// prefix of the algorithm, so a hash can be mapped to its hasher.
+	PasswordHasher interface {
+		Hash(password string) (string, error)
+		Verify(password, hash string) (bool, error)
+		Handles(hash string) bool
+		// Outdated reports if the hash was made with other parameters
+		// than the hasher uses now.
+		Outdated(hash string) bool
+	}
+
+	// PasswordHashers hashes with Hasher and verifies the hashes of
+	// Hasher and Legacy.
+	PasswordHashers struct {
+		Hasher PasswordHasher
+		Legacy []PasswordHasher
+	}
+
+	Argon2idHasher struct {
+		Time    uint32
+		Memory  uint32
+		Threads uint8
+		KeyLen  uint32
+		SaltLen int
+	}
+
+	BcryptHasher struct {
+		Cost int
+	}
+
+	// Sha512Hasher verifies the hashes of aauth.NewSha512Password which
+	// all passwords had before. These hashes have no prefix.
+	Sha512Hasher struct{}
+)
+
+func NewPasswordHashers(name string) (PasswordHashers, error) {
+	switch name {
+	case "", Argon2idHash:
+		p := PasswordHashers{
+			Hasher: DefaultArgon2idHasher,
+			Legacy: []PasswordHasher{DefaultBcryptHasher, Sha512Hasher{}},
+		}
+		return p, nil
+	case BcryptHash:
+		p := PasswordHashers{
+			Hasher: DefaultBcryptHasher,
+			Legacy: []PasswordHasher{DefaultArgon2idHasher, Sha512Hasher{}},
+		}
+		return p, nil
+	}
+
+	m := fmt.Sprintf("Unknown password hasher %v", name)
+	return PasswordHashers{}, errors.New(m)
+}
+
+func (p PasswordHashers) Hash(password string) (string, error) {
+	return p.Hasher.Hash(password)
+}
+
+// Verify returns if the password matches the hash and if the hash should
+// be replaced by a hash of the current Hasher, also when only its
+// parameters changed.
+func (p PasswordHashers) Verify(password, hash string) (bool, bool, error) {
+	hashers := append([]PasswordHasher{p.Hasher}, p.Legacy...)
+	for i, h := range hashers {
+		if !h.Handles(hash) {
+			continue
+		}
+
+		ok, err := h.Verify(password, hash)
+		if err != nil {
+			return false, false, err
+		}
+
+		return ok, ok && (i > 0 || h.Outdated(hash)), nil
+	}
+
+	return false, false, UnknownHashError
+}
+
+// VerifyDummy takes about as long as Verify with a hash of the Hasher, the
+// result does not matter.
+func (p PasswordHashers) VerifyDummy(password string) {
+	for _, hash := range dummyHashes {
+		if p.Hasher.Handles(hash) {
+			p.Hasher.Verify(password, hash)
+			return
+		}
+	}
+
+	p.Hasher.Hash(password)
+}
+
+// The hash has the PHC string format
+// $argon2id$v=19$m=65536,t=1,p=4$<salt>$<key>
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLen)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, h.KeyLen)
+
+	hash := fmt.Sprintf(
+		"$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		h.Memory,
+		h.Time,
+		h.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+
+	return hash, nil
+}
+
+// Returns the parameters the hash was made with, its salt and its key
+func parseArgon2idHash(hash string) (Argon2idHasher, []byte, []byte, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return Argon2idHasher{}, nil, nil, UnknownHashError
+	}
+
+	var version int
+	_, err := fmt.Sscanf(parts[2], "v=%d", &version)
+	if err != nil || version != argon2.Version {
+		return Argon2idHasher{}, nil, nil, UnknownHashError
+	}
+
+	params := Argon2idHasher{}
+	_, err = fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads)
+	if err != nil {
+		return Argon2idHasher{}, nil, nil, UnknownHashError
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2idHasher{}, nil, nil, UnknownHashError
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return Argon2idHasher{}, nil, nil, UnknownHashError
+	}
+
+	params.KeyLen = uint32(len(key))
+	params.SaltLen = len(salt)
+
+	return params, salt, key, nil
+}
+
+func (h Argon2idHasher) Verify(password, hash string) (bool, error) {
+	params, salt, key, err := parseArgon2idHash(hash)
+	if err != nil {
+		return false, err
+	}
+
+	other := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, params.KeyLen)
+
+	return subtle.ConstantTimeCompare(key, other) == 1, nil
+}
+
+func (h Argon2idHasher) Handles(hash string) bool {
+	return strings.HasPrefix(hash, "$argon2id$")
+}
+
+func (h Argon2idHasher) Outdated(hash string) bool {
+	params, _, _, err := parseArgon2idHash(hash)
+	if err != nil {
+		return false
+	}
+
+	return params.Memory != h.Memory ||
+		params.Time != h.Time ||
+		params.Threads != h.Threads ||
+		params.KeyLen != h.KeyLen
+}
+
+func (h BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+func (h BcryptHasher) Verify(password, hash string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (h BcryptHasher) Handles(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") ||
+		strings.HasPrefix(hash, "$2b$") ||
+		strings.HasPrefix(hash, "$2y$")
+}
+
+func (h BcryptHasher) Outdated(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return false
+	}
+
+	return cost != h.Cost
+}
+
+func (h Sha512Hasher) Hash(password string) (string, error) {
+	return aauth.NewSha512Password(password), nil
+}
+
+func (h Sha512Hasher) Verify(password, hash string) (bool, error) {
+	other := aauth.NewSha512Password(password)
+
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(other)) == 1, nil
+}
+
+func (h Sha512Hasher) Handles(hash string) bool {
+	return hash != "" && !strings.HasPrefix(hash, "$")
+}
+
+// The hash has no parameters
+func (h Sha512Hasher) Outdated(hash string) bool {
+	return false
+}
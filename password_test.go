@@ -0,0 +1,155 @@
+package sj
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/rrawrriw/angular-sauth-handler"
+)
+
+func Test_PasswordHasher_OK(t *testing.T) {
+	hashers := []PasswordHasher{
+		DefaultArgon2idHasher,
+		BcryptHasher{Cost: 4},
+		Sha512Hasher{},
+	}
+
+	for _, h := range hashers {
+		hash, err := h.Hash("secret")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !h.Handles(hash) {
+			t.Fatal("Expect", h, "handles", hash)
+		}
+
+		ok, err := h.Verify("secret", hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !ok {
+			t.Fatal("Expect", hash, "matches")
+		}
+
+		ok, err = h.Verify("wrong", hash)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ok {
+			t.Fatal("Expect", hash, "does not match")
+		}
+	}
+}
+
+func Test_PasswordHashers_Verify_OK(t *testing.T) {
+	p, err := NewPasswordHashers(BcryptHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := p.Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(hash, "$2a$") {
+		t.Fatal("Expect a bcrypt hash was", hash)
+	}
+
+	ok, rehash, err := p.Verify("secret", hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ok || rehash {
+		t.Fatal("Expect match without rehash was", ok, rehash)
+	}
+
+	legacy := aauth.NewSha512Password("secret")
+	ok, rehash, err = p.Verify("secret", legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ok || !rehash {
+		t.Fatal("Expect match with rehash was", ok, rehash)
+	}
+
+	ok, rehash, err = p.Verify("wrong", legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok || rehash {
+		t.Fatal("Expect no match was", ok, rehash)
+	}
+}
+
+// Hashes of the Hasher with older parameters are replaced too
+func Test_PasswordHashers_Verify_RehashParameters(t *testing.T) {
+	p, err := NewPasswordHashers(Argon2idHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := DefaultArgon2idHasher
+	old.Memory = 32 * 1024
+	old.KeyLen = 16
+	hash, err := old.Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok, rehash, err := p.Verify("secret", hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ok || !rehash {
+		t.Fatal("Expect match with rehash was", ok, rehash)
+	}
+
+	hash, err = p.Hash("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ok, rehash, err = p.Verify("secret", hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ok || rehash {
+		t.Fatal("Expect match without rehash was", ok, rehash)
+	}
+}
+
+// The dummy hashes have to be valid hashes of the configurable hashers
+func Test_PasswordHashers_VerifyDummy_OK(t *testing.T) {
+	for _, name := range []string{Argon2idHash, BcryptHash} {
+		p, err := NewPasswordHashers(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		found := false
+		for _, hash := range dummyHashes {
+			if !p.Hasher.Handles(hash) {
+				continue
+			}
+			found = true
+
+			_, err := p.Hasher.Verify("secret", hash)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if !found {
+			t.Fatal("Expect a dummy hash for", name)
+		}
+	}
+}
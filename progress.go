@@ -0,0 +1,190 @@
+package sj
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type (
+	EpisodeNumber struct {
+		Session int
+		Episode int
+	}
+
+	// SeriesProgress is the watch state of a user in a series. LastWatched
+	// is the latest watched episode in the order of the series, Next the
+	// episode after it or, if that is the end like after a special, the
+	// first unwatched episode. Both are nil if there is no such episode.
+	SeriesProgress struct {
+		Episodes    int
+		Watched     int
+		LastWatched *EpisodeNumber
+		Next        *Episode
+	}
+
+	SeriesDetailData struct {
+		Series
+		Progress SeriesProgress
+	}
+
+	// NextUpData is a series of the next up feed, the Next of the
+	// Progress is never nil. LastWatched is zero for unwatched series.
+	NextUpData struct {
+		SeriesID    bson.ObjectId
+		Title       string
+		LastWatched time.Time
+		Progress    SeriesProgress
+	}
+
+	// Latest watched series first, unwatched series by title
+	nextUpByWatched []NextUpData
+)
+
+func (l nextUpByWatched) Len() int {
+	return len(l)
+}
+
+func (l nextUpByWatched) Less(x, y int) bool {
+	if !l[x].LastWatched.Equal(l[y].LastWatched) {
+		return l[x].LastWatched.After(l[y].LastWatched)
+	}
+
+	return l[x].Title < l[y].Title
+}
+
+func (l nextUpByWatched) Swap(x, y int) {
+	l[x], l[y] = l[y], l[x]
+}
+
+// NewSeriesProgress sorts the episodes in the order of the series
+func NewSeriesProgress(episodes, watched Episodes, order string) SeriesProgress {
+	SortEpisodes(episodes, order)
+
+	watchedIDs := []bson.ObjectId{}
+	for _, e := range watched {
+		watchedIDs = append(watchedIDs, e.ID)
+	}
+
+	p := SeriesProgress{
+		Episodes: len(episodes),
+	}
+
+	last := -1
+	for i, e := range episodes {
+		if ContainsID(watchedIDs, e.ID) {
+			p.Watched++
+			last = i
+		}
+	}
+
+	if last >= 0 {
+		p.LastWatched = &EpisodeNumber{
+			Session: episodes[last].Session,
+			Episode: episodes[last].Episode,
+		}
+	}
+
+	if last+1 < len(episodes) {
+		next := episodes[last+1]
+		p.Next = &next
+		return p
+	}
+
+	for _, e := range episodes {
+		if !ContainsID(watchedIDs, e.ID) {
+			next := e
+			p.Next = &next
+			break
+		}
+	}
+
+	return p
+}
+
+// ReadSeriesProgress reads the progress of the user in the series
+func ReadSeriesProgress(store Store, userID bson.ObjectId, series Series) (SeriesProgress, error) {
+	episodes, err := store.ReadEpisodes(series.ID)
+	if err != nil {
+		return SeriesProgress{}, err
+	}
+
+	watched, err := store.ReadWatchedEpisodes(userID, series.ID)
+	if err != nil {
+		return SeriesProgress{}, err
+	}
+
+	return NewSeriesProgress(episodes, watched, series.Order), nil
+}
+
+// NewNextUp returns the next episode of every series which is not watched
+// to the end, the states are the episodes of all series.
+func NewNextUp(series []Series, states []EpisodeState) []NextUpData {
+	episodes := map[bson.ObjectId]Episodes{}
+	watched := map[bson.ObjectId]Episodes{}
+	lastWatched := map[bson.ObjectId]time.Time{}
+	for _, s := range states {
+		episodes[s.SeriesID] = append(episodes[s.SeriesID], s.Episode)
+		if s.Watched.IsZero() {
+			continue
+		}
+
+		watched[s.SeriesID] = append(watched[s.SeriesID], s.Episode)
+		if s.Watched.After(lastWatched[s.SeriesID]) {
+			lastWatched[s.SeriesID] = s.Watched
+		}
+	}
+
+	feed := nextUpByWatched{}
+	seen := []bson.ObjectId{}
+	for _, s := range series {
+		if ContainsID(seen, s.ID) {
+			continue
+		}
+		seen = append(seen, s.ID)
+
+		p := NewSeriesProgress(episodes[s.ID], watched[s.ID], s.Order)
+		if p.Next == nil {
+			continue
+		}
+
+		d := NextUpData{
+			SeriesID:    s.ID,
+			Title:       s.Title,
+			LastWatched: lastWatched[s.ID],
+			Progress:    p,
+		}
+		feed = append(feed, d)
+	}
+
+	sort.Sort(feed)
+
+	return feed
+}
+
+// Returns the next episodes of the series of the session user, the
+// episodes of all series are read at once.
+func ReadNextUpHandler(c *gin.Context, app AppContext) error {
+	store := app.Store()
+	user, err := ReadSessionUser(c, store)
+	if err != nil {
+		return err
+	}
+
+	series, err := store.ReadSeriesOfUser(user.Id)
+	if err != nil {
+		return err
+	}
+
+	states, err := store.ReadEpisodeStates(user.Id)
+	if err != nil {
+		return err
+	}
+
+	c.JSON(http.StatusOK, NewSuccessResponse(NewNextUp(series, states)))
+
+	return nil
+}
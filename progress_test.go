@@ -0,0 +1,242 @@
+package sj
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type SeriesDetailResponse struct {
+	Status string
+	Data   SeriesDetailData
+}
+
+func Test_NewSeriesProgress_OK(t *testing.T) {
+	episodes := Episodes{
+		{ID: bson.NewObjectId(), Session: 3, Episode: 1},
+		{ID: bson.NewObjectId(), Session: 1, Episode: 1},
+		{ID: bson.NewObjectId(), Session: 2, Episode: 1},
+	}
+	watched := Episodes{episodes[1], episodes[2]}
+
+	p := NewSeriesProgress(episodes, watched, SeasonOrder)
+
+	if p.Episodes != 3 || p.Watched != 2 {
+		t.Fatal("Expect 2 of 3 watched was", p)
+	}
+
+	if p.LastWatched == nil || *p.LastWatched != (EpisodeNumber{Session: 2, Episode: 1}) {
+		t.Fatal("Expect S2E1 was", p.LastWatched)
+	}
+
+	if p.Next == nil || p.Next.Session != 3 {
+		t.Fatal("Expect S3E1 was", p.Next)
+	}
+
+	p = NewSeriesProgress(episodes, Episodes{}, SeasonOrder)
+	if p.LastWatched != nil || p.Next == nil || p.Next.Session != 1 {
+		t.Fatal("Expect S1E1 next was", p)
+	}
+
+	p = NewSeriesProgress(episodes, episodes, SeasonOrder)
+	if p.Watched != 3 || p.Next != nil {
+		t.Fatal("Expect all watched was", p)
+	}
+}
+
+func Test_GET_Series_OK(t *testing.T) {
+	app := NewTestApp(t)
+	store := app.Store()
+	defer CleanTestStore(store, t)
+
+	user, session, sList := NewTestDBEnv(t, store)
+	auth := SessionAuth(app)
+
+	ids := []bson.ObjectId{}
+	for i := 1; i <= 3; i++ {
+		e := Episode{
+			SeriesID: sList[0].ID,
+			Title:    fmt.Sprintf("Episode %v", i),
+			Session:  i,
+			Episode:  1,
+		}
+		id, err := store.NewEpisode(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	err := store.WatchEpisode(user.Id, ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := gin.New()
+	req := TestRequest{
+		Body:    "",
+		Header:  http.Header{},
+		Handler: handler,
+	}
+
+	handler.GET("/series/:id", auth, NewAppHandler(ReadSeriesHandler, app))
+
+	resp := req.SendWithToken("GET", "/series/"+sList[0].ID.Hex(), session.Token)
+	if resp.Code != http.StatusOK {
+		t.Fatal("Expect", http.StatusOK, "was", resp.Code, resp.Body)
+	}
+
+	detail := SeriesDetailResponse{}
+	err = json.Unmarshal(resp.Body.Bytes(), &detail)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if detail.Data.ID != sList[0].ID || detail.Data.Title != sList[0].Title {
+		t.Fatal("Expect", sList[0], "was", detail.Data.Series)
+	}
+
+	p := detail.Data.Progress
+	if p.Episodes != 3 || p.Watched != 1 || p.Next == nil || p.Next.ID != ids[1] {
+		t.Fatal("Expect next", ids[1], "was", resp.Body)
+	}
+}
+
+func Test_GET_Series_FailForeignSeries(t *testing.T) {
+	app := NewTestApp(t)
+	store := app.Store()
+	defer CleanTestStore(store, t)
+
+	_, session, _ := NewTestDBEnv(t, store)
+	auth := SessionAuth(app)
+
+	other, err := store.NewSeries(Series{Title: "The Wire"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := gin.New()
+	req := TestRequest{
+		Body:    "",
+		Header:  http.Header{},
+		Handler: handler,
+	}
+
+	handler.GET("/series/:id", auth, NewAppHandler(ReadSeriesHandler, app))
+
+	resp := req.SendWithToken("GET", "/series/"+other.Hex(), session.Token)
+	if resp.Code != http.StatusForbidden {
+		t.Fatal("Expect", http.StatusForbidden, "was", resp.Code, resp.Body)
+	}
+}
+
+type NextUpResponse struct {
+	Status string
+	Data   []NextUpData
+}
+
+func Test_NewNextUp_OK(t *testing.T) {
+	series := []Series{
+		{ID: bson.NewObjectId(), Title: "The Wire"},
+		{ID: bson.NewObjectId(), Title: "Narcos"},
+		{ID: bson.NewObjectId(), Title: "Mr. Robot"},
+		{ID: bson.NewObjectId(), Title: "Dark"},
+	}
+	// The Wire is followed twice
+	series = append(series, series[0])
+
+	now := time.Now()
+	states := []EpisodeState{
+		{Episode: Episode{ID: bson.NewObjectId(), SeriesID: series[0].ID, Session: 1, Episode: 1}},
+		{Episode: Episode{ID: bson.NewObjectId(), SeriesID: series[1].ID, Session: 1, Episode: 1}, Watched: now.Add(-time.Hour)},
+		{Episode: Episode{ID: bson.NewObjectId(), SeriesID: series[1].ID, Session: 2, Episode: 1}},
+		{Episode: Episode{ID: bson.NewObjectId(), SeriesID: series[2].ID, Session: 1, Episode: 1}, Watched: now},
+		{Episode: Episode{ID: bson.NewObjectId(), SeriesID: series[2].ID, Session: 2, Episode: 1}},
+		{Episode: Episode{ID: bson.NewObjectId(), SeriesID: series[3].ID, Session: 1, Episode: 1}, Watched: now},
+	}
+
+	feed := NewNextUp(series, states)
+
+	// Dark is watched to the end
+	expect := []string{"Mr. Robot", "Narcos", "The Wire"}
+	if len(feed) != len(expect) {
+		t.Fatal("Expect", expect, "was", feed)
+	}
+
+	for i, title := range expect {
+		if feed[i].Title != title {
+			t.Fatal("Expect", title, "was", feed[i].Title)
+		}
+	}
+
+	if feed[1].Progress.Next.ID != states[2].ID || !feed[1].LastWatched.Equal(now.Add(-time.Hour)) {
+		t.Fatal("Expect", states[2], "was", feed[1])
+	}
+}
+
+func Test_GET_NextUp_OK(t *testing.T) {
+	app := NewTestApp(t)
+	store := app.Store()
+	defer CleanTestStore(store, t)
+
+	user, session, sList := NewTestDBEnv(t, store)
+	auth := SessionAuth(app)
+
+	ids := map[bson.ObjectId][]bson.ObjectId{}
+	for _, s := range sList {
+		for i := 1; i <= 2; i++ {
+			e := Episode{
+				SeriesID: s.ID,
+				Title:    fmt.Sprintf("%v %v", s.Title, i),
+				Session:  i,
+				Episode:  1,
+			}
+			id, err := store.NewEpisode(e)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids[s.ID] = append(ids[s.ID], id)
+		}
+	}
+
+	for _, s := range []Series{sList[0], sList[1]} {
+		err := store.WatchEpisode(user.Id, ids[s.ID][0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	handler := gin.New()
+	req := TestRequest{
+		Body:    "",
+		Header:  http.Header{},
+		Handler: handler,
+	}
+
+	handler.GET("/next", auth, NewAppHandler(ReadNextUpHandler, app))
+
+	resp := req.SendWithToken("GET", "/next", session.Token)
+	if resp.Code != http.StatusOK {
+		t.Fatal("Expect", http.StatusOK, "was", resp.Code, resp.Body)
+	}
+
+	feed := NextUpResponse{}
+	err := json.Unmarshal(resp.Body.Bytes(), &feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The last watched series comes first
+	if len(feed.Data) != 2 ||
+		feed.Data[0].SeriesID != sList[1].ID ||
+		feed.Data[0].Progress.Next.ID != ids[sList[1].ID][1] ||
+		feed.Data[1].SeriesID != sList[0].ID {
+		t.Fatal("Expect", sList[1].Title, "first was", resp.Body)
+	}
+}
@@ -0,0 +1,159 @@
+package sj
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	InvalidNameCode     = "invalid_name"
+	InvalidPasswordCode = "invalid_password"
+)
+
+var (
+	RegistrationClosedError = NewAPIError(http.StatusForbidden, "registration_closed", "Registration is closed")
+	InviteCodeError         = NewAPIError(http.StatusForbidden, "wrong_invite", "Wrong invite code")
+
+	DefaultRegistrationPolicy = RegistrationPolicy{
+		NameMinLen:     3,
+		NameMaxLen:     32,
+		NamePattern:    regexp.MustCompile(`^[A-Za-z0-9_.-]+$`),
+		PasswordMinLen: 8,
+		// bcrypt ignores everything behind 72 bytes
+		PasswordMaxLen: 72,
+	}
+)
+
+type (
+	// RegistrationPolicy decides who can sign up and which names and
+	// passwords are allowed. Without InviteCodes everybody can sign up
+	// as long as the registration is not Closed.
+	RegistrationPolicy struct {
+		Closed         bool
+		InviteCodes    []string
+		NameMinLen     int
+		NameMaxLen     int
+		NamePattern    *regexp.Regexp
+		PasswordMinLen int
+		PasswordMaxLen int
+	}
+
+	RegistrationRequest struct {
+		User   User
+		Invite string
+	}
+
+	RegistrationBody struct {
+		UserBody
+		Invite string
+	}
+)
+
+func NewRegistrationPolicy(specs Specs) RegistrationPolicy {
+	p := DefaultRegistrationPolicy
+	p.Closed = specs.RegistrationClosed
+	p.InviteCodes = specs.InviteCodes
+
+	if specs.PasswordMinLen > 0 {
+		p.PasswordMinLen = specs.PasswordMinLen
+	}
+
+	return p
+}
+
+func (p RegistrationPolicy) CheckName(name string) error {
+	v := &Validator{}
+	p.checkName(v, name)
+	return v.Err()
+}
+
+func (p RegistrationPolicy) checkName(v *Validator, name string) {
+	n := utf8.RuneCountInString(name)
+	if n < p.NameMinLen || n > p.NameMaxLen {
+		m := fmt.Sprintf("Name must have %v to %v characters", p.NameMinLen, p.NameMaxLen)
+		v.Add("Name", InvalidNameCode, m)
+	}
+
+	if p.NamePattern != nil && !p.NamePattern.MatchString(name) {
+		v.Add("Name", InvalidNameCode, "Name contains forbidden characters")
+	}
+}
+
+func (p RegistrationPolicy) CheckPassword(name, password string) error {
+	v := &Validator{}
+	p.checkPassword(v, name, password)
+	return v.Err()
+}
+
+func (p RegistrationPolicy) checkPassword(v *Validator, name, password string) {
+	if utf8.RuneCountInString(password) < p.PasswordMinLen {
+		m := fmt.Sprintf("Password must have at least %v characters", p.PasswordMinLen)
+		v.Add("Password", InvalidPasswordCode, m)
+	}
+
+	if p.PasswordMaxLen > 0 && len(password) > p.PasswordMaxLen {
+		m := fmt.Sprintf("Password must have at most %v bytes", p.PasswordMaxLen)
+		v.Add("Password", InvalidPasswordCode, m)
+	}
+
+	if strings.EqualFold(name, password) {
+		v.Add("Password", InvalidPasswordCode, "Password must differ from the name")
+	}
+}
+
+func (p RegistrationPolicy) CheckInvite(code string) error {
+	if len(p.InviteCodes) == 0 {
+		return nil
+	}
+
+	for _, c := range p.InviteCodes {
+		if subtle.ConstantTimeCompare([]byte(c), []byte(code)) == 1 {
+			return nil
+		}
+	}
+
+	return InviteCodeError
+}
+
+// Check runs every rule of the policy against the registration. A closed
+// registration or a wrong invite stop it, the problems of the name and
+// the password are reported together.
+func (p RegistrationPolicy) Check(r RegistrationRequest) error {
+	if p.Closed {
+		return RegistrationClosedError
+	}
+
+	err := p.CheckInvite(r.Invite)
+	if err != nil {
+		return err
+	}
+
+	v := &Validator{}
+	p.checkName(v, r.User.Name)
+	p.checkPassword(v, r.User.Name, r.User.Pass)
+
+	return v.Err()
+}
+
+func ParseRegistrationRequest(r *http.Request) (RegistrationRequest, error) {
+	body, err := DecodeRequest[RegistrationBody](r)
+	if err != nil {
+		return RegistrationRequest{}, err
+	}
+
+	user, err := ParseUserBody(body.UserBody)
+	if err != nil {
+		return RegistrationRequest{}, err
+	}
+
+	reg := RegistrationRequest{
+		User:   user,
+		Invite: body.Invite,
+	}
+
+	return reg, nil
+}
@@ -0,0 +1,160 @@
+package sj
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func Test_RegistrationPolicy_Check_OK(t *testing.T) {
+	p := DefaultRegistrationPolicy
+	p.InviteCodes = []string{"friends"}
+
+	valid := RegistrationRequest{
+		User: User{
+			Name: "greatLover99",
+			Pass: "love!machine",
+		},
+		Invite: "friends",
+	}
+
+	err := p.Check(valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := []RegistrationRequest{
+		{User: User{Name: "", Pass: "love!machine"}, Invite: "friends"},
+		{User: User{Name: "great lover", Pass: "love!machine"}, Invite: "friends"},
+		{User: User{Name: "greatLover99", Pass: "love!"}, Invite: "friends"},
+		{User: User{Name: "greatLover99", Pass: "GREATLOVER99"}, Invite: "friends"},
+		{User: User{Name: "greatLover99", Pass: "love!machine"}, Invite: "enemies"},
+	}
+
+	for _, r := range invalid {
+		err := p.Check(r)
+		if err == nil {
+			t.Fatal("Expect an error for", r)
+		}
+	}
+
+	p.Closed = true
+	err = p.Check(valid)
+	if err != RegistrationClosedError {
+		t.Fatal("Expect", RegistrationClosedError, "was", err)
+	}
+}
+
+func Test_POST_NewUser_FailRegistrationClosed(t *testing.T) {
+	app := NewTestApp(t)
+	app.Specs.RegistrationClosed = true
+	store := app.Store()
+	defer CleanTestStore(store, t)
+
+	handler := gin.New()
+	req := TestRequest{
+		Body: `
+		{
+			"Data": {
+				"Name": "machine_XXX",
+				"Password": "love!machine"
+			}
+		}`,
+		Header:  http.Header{},
+		Handler: handler,
+	}
+
+	handler.POST("/", NewAppHandler(NewUserHandler, app))
+
+	resp := req.Send("POST", "/")
+
+	expectResp := NewFailResponse(RegistrationClosedError)
+	err := EqualFailResponse(resp.Body, expectResp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.FindUser("machine_XXX")
+	if err != NotFoundError {
+		t.Fatal("Expect", NotFoundError, "was", err)
+	}
+}
+
+func Test_NewUser_FailUniqueName(t *testing.T) {
+	store := NewTestStore(t)
+	defer CleanTestStore(store, t)
+
+	user := User{
+		Name: "machine_XXX",
+		Pass: "love!machine",
+	}
+	_, err := store.NewUser(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.NewUser(user)
+	if err != UserExistsError {
+		t.Fatal("Expect", UserExistsError, "was", err)
+	}
+
+	otherID, err := store.NewUser(User{Name: "otherLover"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.UpdateUser(otherID, ChangeUser{Name: user.Name})
+	if err != UserExistsError {
+		t.Fatal("Expect", UserExistsError, "was", err)
+	}
+
+	// Names differing only in case are taken too
+	_, err = store.NewUser(User{Name: "MACHINE_xxx"})
+	if err != UserExistsError {
+		t.Fatal("Expect", UserExistsError, "was", err)
+	}
+
+	err = store.UpdateUser(otherID, ChangeUser{Name: "Machine_XXX"})
+	if err != UserExistsError {
+		t.Fatal("Expect", UserExistsError, "was", err)
+	}
+
+	// Keeping the own name is no conflict, also in another case
+	err = store.UpdateUser(otherID, ChangeUser{Name: "OtherLover"})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_RegistrationPolicy_Check_FailAllFields(t *testing.T) {
+	r := RegistrationRequest{
+		User: User{
+			Name: "x!",
+			Pass: "X!",
+		},
+	}
+
+	err := DefaultRegistrationPolicy.Check(r)
+	e, ok := err.(*APIError)
+	if !ok {
+		t.Fatal("Expect an APIError was", err)
+	}
+
+	expect := []FieldError{
+		{Field: "Name", Code: InvalidNameCode},
+		{Field: "Name", Code: InvalidNameCode},
+		{Field: "Password", Code: InvalidPasswordCode},
+		{Field: "Password", Code: InvalidPasswordCode},
+	}
+
+	if e.Code != InvalidFieldsCode || len(e.Fields) != len(expect) {
+		t.Fatal("Expect", expect, "was", e.Fields)
+	}
+
+	for i, f := range expect {
+		if e.Fields[i].Field != f.Field || e.Fields[i].Code != f.Code {
+			t.Fatal("Expect", f, "was", e.Fields[i])
+		}
+	}
+}
@@ -0,0 +1,262 @@
+package sj
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// Size limits of request bodies in bytes, see BodyLimit
+	DefaultMaxBodySize      = 1 << 20
+	DefaultMaxBatchBodySize = 16 << 20
+
+	// The body before BodyLimit wrapped it
+	RawBodyKey = "RawBody"
+
+	UnknownFieldCode = "unknown_field"
+	TooLargeCode     = "request_too_large"
+	MediaTypeCode    = "unsupported_media_type"
+)
+
+var (
+	RequestTooLargeError = NewAPIError(http.StatusRequestEntityTooLarge, TooLargeCode, "Request is too large")
+	MediaTypeError       = NewAPIError(http.StatusUnsupportedMediaType, MediaTypeCode, "Request is no application/json")
+	EmptyRequestError    = NewAPIError(http.StatusBadRequest, InvalidJSONCode, "Request is empty")
+	TrailingDataError    = NewAPIError(http.StatusBadRequest, InvalidJSONCode, "Request has data after the JSON")
+)
+
+type (
+	// Request is the envelope of every JSON request, the handlers
+	// declare the type of the Data.
+	Request[T any] struct {
+		Data *T
+	}
+
+	// limitedBody marks a body which BodyLimit limits
+	limitedBody struct {
+		io.ReadCloser
+	}
+
+	// ResourceBody is a Resource of a request, nil fields are missing
+	ResourceBody struct {
+		Name *string
+		URL  *string
+	}
+
+	// ResourcesBody is a list of resources or, like older clients send
+	// it, a single resource. An empty single resource is an empty list.
+	// A value which is no resource is decoded to nil, the Validator
+	// reports it with the path of the field.
+	ResourcesBody []ResourceBody
+
+	// ResourceChangeBody is {"Append": [...]}, {"Remove": [...]},
+	// {"Replace": [...]} or the new resources itself, Op is empty then.
+	ResourceChangeBody struct {
+		Op        string
+		Resources ResourcesBody
+	}
+)
+
+// BodyLimit fails the reads of a request body after max bytes, the
+// handlers reply with RequestTooLargeError then. A later BodyLimit of a
+// route replaces the limit of the router, batch endpoints use it to
+// accept larger bodies.
+func BodyLimit(max int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		raw := c.Request.Body
+		v, err := c.Get(RawBodyKey)
+		if body, ok := v.(io.ReadCloser); err == nil && ok {
+			raw = body
+		}
+		c.Set(RawBodyKey, raw)
+
+		if raw != nil {
+			c.Request.Body = limitedBody{http.MaxBytesReader(c.Writer, raw, max)}
+		}
+
+		c.Next()
+	}
+}
+
+// DecodeStrict decodes the JSON and fails on unknown fields
+func DecodeStrict(r io.Reader, v interface{}) error {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(v)
+	if err == io.EOF {
+		return EmptyRequestError
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// More is false for a closing } or ], only the end is no trailing data
+	_, err = dec.Token()
+	if err != io.EOF {
+		return TrailingDataError
+	}
+
+	return nil
+}
+
+// requestField turns the field of a decode error like Data.1.Title into
+// the path of the Validator like [1].Title.
+func requestField(field string) string {
+	path := ""
+	for _, key := range strings.Split(field, ".") {
+		i, err := strconv.Atoi(key)
+		if err == nil {
+			path = indexPath(path, i)
+			continue
+		}
+		path = fieldPath(path, key)
+	}
+
+	path = strings.TrimPrefix(path, "Data")
+	path = strings.TrimPrefix(path, ".")
+	if path == "" {
+		return "Data"
+	}
+
+	return path
+}
+
+func decodeError(err error) error {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		return RequestTooLargeError
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return NewWrongFieldError(requestField(typeErr.Field))
+	}
+
+	// encoding/json has no type for this error
+	msg := err.Error()
+	if strings.HasPrefix(msg, "json: unknown field ") {
+		field := strings.Trim(strings.TrimPrefix(msg, "json: unknown field "), `"`)
+		m := fmt.Sprintf("Unknown %v field", field)
+		return NewFieldError(UnknownFieldCode, field, m)
+	}
+
+	return err
+}
+
+// DecodeRequest reads the JSON request {"Data": ...} and returns the Data.
+// Requests without a Content-Type are read as JSON. The body is decoded
+// while it is read, bodies of routes without BodyLimit are limited to
+// DefaultMaxBodySize.
+func DecodeRequest[T any](r *http.Request) (T, error) {
+	var data T
+
+	contentType := r.Header.Get("Content-Type")
+	if contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || mediaType != "application/json" {
+			return data, MediaTypeError
+		}
+	}
+
+	var body io.Reader = r.Body
+	if _, ok := r.Body.(limitedBody); !ok {
+		body = http.MaxBytesReader(nil, r.Body, DefaultMaxBodySize)
+	}
+
+	req := Request[T]{}
+	err := DecodeStrict(body, &req)
+	if err != nil {
+		return data, decodeError(err)
+	}
+
+	if req.Data == nil {
+		return data, NewMissingFieldError("Data")
+	}
+
+	return *req.Data, nil
+}
+
+// Unknown fields fail the request like in DecodeRequest. Other problems
+// leave the list nil for the Validator, which knows the path of the field.
+func resourcesError(err error) error {
+	e, ok := decodeError(err).(*APIError)
+	if ok && e.Code == UnknownFieldCode {
+		return e
+	}
+
+	return nil
+}
+
+func (l *ResourcesBody) UnmarshalJSON(data []byte) error {
+	*l = nil
+
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("[")) {
+		items := []ResourceBody{}
+		err := DecodeStrict(bytes.NewReader(data), &items)
+		if err != nil {
+			return resourcesError(err)
+		}
+
+		*l = items
+		return nil
+	}
+
+	if !bytes.HasPrefix(data, []byte("{")) {
+		return nil
+	}
+
+	r := ResourceBody{}
+	err := DecodeStrict(bytes.NewReader(data), &r)
+	if err != nil {
+		return resourcesError(err)
+	}
+
+	// Older clients send an empty resource instead of none
+	if r.Name != nil && r.URL != nil && *r.Name == "" && *r.URL == "" {
+		*l = ResourcesBody{}
+		return nil
+	}
+
+	*l = ResourcesBody{r}
+
+	return nil
+}
+
+// A change with more than one operation is decoded like a wrong value
+func (c *ResourceChangeBody) UnmarshalJSON(data []byte) error {
+	c.Op = ""
+	c.Resources = nil
+
+	m := map[string]json.RawMessage{}
+	if json.Unmarshal(data, &m) != nil {
+		return c.Resources.UnmarshalJSON(data)
+	}
+
+	for _, op := range []string{"Append", "Remove", "Replace"} {
+		val, ok := m[op]
+		if !ok {
+			continue
+		}
+
+		if len(m) != 1 {
+			return nil
+		}
+
+		c.Op = op
+		return c.Resources.UnmarshalJSON(val)
+	}
+
+	return c.Resources.UnmarshalJSON(data)
+}
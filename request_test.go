@@ -0,0 +1,196 @@
+package sj
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"testing"
+)
+
+func NewTestRequest(body, contentType string) *http.Request {
+	req, err := http.NewRequest("POST", "/", bytes.NewReader([]byte(body)))
+	if err != nil {
+		panic(err)
+	}
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	return req
+}
+
+func Test_DecodeRequest_OK(t *testing.T) {
+	body := `{"Data": {"Name": "Alice", "Password": "secret"}}`
+	req := NewTestRequest(body, "application/json; charset=utf-8")
+
+	data, err := DecodeRequest[UserBody](req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if data.Name == nil || *data.Name != "Alice" || data.Password == nil {
+		t.Fatal("Expect Alice was", data)
+	}
+}
+
+func Test_DecodeRequest_Fail(t *testing.T) {
+	cases := []struct {
+		Body        string
+		ContentType string
+		Code        string
+		Field       string
+	}{
+		{`{"Data": {"Name": "Alice", "Admin": true}}`, "", UnknownFieldCode, "Admin"},
+		{`{"Data": {"Name": 1}}`, "", WrongFieldCode, "Name"},
+		{`{"Data": []}`, "", WrongFieldCode, "Data"},
+		{`{}`, "", MissingFieldCode, "Data"},
+		{`{"Data": {}} {}`, "", InvalidJSONCode, ""},
+		{`{"Data": {}} }`, "", InvalidJSONCode, ""},
+		{`{"Data": {}} ]`, "", InvalidJSONCode, ""},
+		{``, "", InvalidJSONCode, ""},
+		{`{"Data": {}}`, "text/plain", MediaTypeCode, ""},
+	}
+
+	for _, c := range cases {
+		_, err := DecodeRequest[UserBody](NewTestRequest(c.Body, c.ContentType))
+		e := ToAPIError(err)
+		if e.Code != c.Code {
+			t.Fatal("Expect", c.Code, "was", e.Code, e.Message)
+		}
+
+		if c.Field != "" && (len(e.Fields) != 1 || e.Fields[0].Field != c.Field) {
+			t.Fatal("Expect", c.Field, "was", e.Fields)
+		}
+	}
+}
+
+func Test_DecodeRequest_FailDefaultLimit(t *testing.T) {
+	body := `{"Data": {"Name": "` + strings.Repeat("x", DefaultMaxBodySize) + `"}}`
+
+	_, err := DecodeRequest[UserBody](NewTestRequest(body, ""))
+	if err != RequestTooLargeError {
+		t.Fatal("Expect", RequestTooLargeError, "was", err)
+	}
+}
+
+func Test_ParseNewEpisodeBatchRequest_FailWrongType(t *testing.T) {
+	body := `{"Data": [{"Title": "Pilot", "Session": 1, "Episode": 1}, {"Title": 2, "Session": 1, "Episode": 2}]}`
+
+	_, err := ParseNewEpisodeBatchRequest(NewTestRequest(body, ""))
+
+	expect := []FieldError{
+		{Field: "[1].Title", Code: WrongFieldCode},
+	}
+	if !EqualFieldErrors(err, expect) {
+		t.Fatal("Expect", expect, "was", err)
+	}
+}
+
+func Test_ParseChangeSeriesRequest_FailTwoOperations(t *testing.T) {
+	body := `{"Data": {"Portal": {"Append": [], "Remove": []}}}`
+
+	_, err := ParseChangeSeriesRequest(NewTestRequest(body, ""))
+
+	expect := []FieldError{
+		{Field: "Portal", Code: WrongFieldCode},
+	}
+	if !EqualFieldErrors(err, expect) {
+		t.Fatal("Expect", expect, "was", err)
+	}
+}
+
+// Unknown fields of a resource fail the request like the other fields
+func Test_ParseChangeSeriesRequest_FailUnknownResourceField(t *testing.T) {
+	bodies := []string{
+		`{"Data": {"Image": {"Name": "kinox.to", "URL": "http://kinox.to", "Rating": 5}}}`,
+		`{"Data": {"Portal": {"Append": [{"Name": "kinox.to", "URL": "http://kinox.to", "Rating": 5}]}}}`,
+	}
+
+	for _, body := range bodies {
+		_, err := ParseChangeSeriesRequest(NewTestRequest(body, ""))
+
+		expect := []FieldError{
+			{Field: "Rating", Code: UnknownFieldCode},
+		}
+		if !EqualFieldErrors(err, expect) {
+			t.Fatal("Expect", expect, "was", err)
+		}
+
+		if ToAPIError(err).Status != http.StatusBadRequest {
+			t.Fatal("Expect", http.StatusBadRequest, "was", ToAPIError(err).Status)
+		}
+	}
+}
+
+func NewBodyLimitTestHandler(limits ...gin.HandlerFunc) http.Handler {
+	decode := func(c *gin.Context, app AppContext) error {
+		_, err := DecodeRequest[UserBody](c.Request)
+		if err != nil {
+			return err
+		}
+
+		c.JSON(http.StatusOK, NewSuccessResponse(nil))
+
+		return nil
+	}
+
+	router := gin.New()
+	handlers := append(limits, NewAppHandler(decode, AppCtx{}))
+	router.POST("/", handlers...)
+
+	return router
+}
+
+func Test_BodyLimit_OK(t *testing.T) {
+	name := strings.Repeat("x", 100)
+	body := `{"Data": {"Name": "` + name + `", "Password": "secret"}}`
+
+	// The limit of the route replaces the smaller limit of the router
+	handler := NewBodyLimitTestHandler(BodyLimit(50), BodyLimit(200))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, NewTestRequest(body, ""))
+
+	if w.Code != http.StatusOK {
+		t.Fatal("Expect", http.StatusOK, "was", w.Code, w.Body)
+	}
+}
+
+func Test_BodyLimit_OKAboveDefault(t *testing.T) {
+	name := strings.Repeat("x", DefaultMaxBodySize)
+	body := `{"Data": {"Name": "` + name + `", "Password": "secret"}}`
+
+	handler := NewBodyLimitTestHandler(BodyLimit(2 * DefaultMaxBodySize))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, NewTestRequest(body, ""))
+
+	if w.Code != http.StatusOK {
+		t.Fatal("Expect", http.StatusOK, "was", w.Code)
+	}
+}
+
+func Test_BodyLimit_FailTooLarge(t *testing.T) {
+	name := strings.Repeat("x", 100)
+	body := `{"Data": {"Name": "` + name + `", "Password": "secret"}}`
+
+	handler := NewBodyLimitTestHandler(BodyLimit(50))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, NewTestRequest(body, ""))
+
+	fail := FailResponse{}
+	err := json.Unmarshal(w.Body.Bytes(), &fail)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if w.Code != http.StatusRequestEntityTooLarge || fail.Code != TooLargeCode {
+		t.Fatal("Expect", TooLargeCode, "was", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,57 @@
+package sj
+
+import "github.com/gin-gonic/gin"
+
+// APIRoutes registers the handlers of the api on group, the server mounts
+// them at /api.
+//
+// SessionAuth replaces the aauth middleware, it checks the same
+// X-XSRF-TOKEN sessions against the Store of the app instead of a
+// MongoDB. Account, session and token management need a browser
+// session, everything else accepts personal API tokens too.
+func APIRoutes(api *gin.RouterGroup, app AppCtx) {
+	auth := SessionAuth(app)
+	apiAuth := BearerAuth(app)
+	admin := AdminAuth(app)
+	h := func(handler AppHandler) gin.HandlerFunc {
+		return NewAppHandler(handler, app)
+	}
+
+	// Batch endpoints replace the body limit of the api group
+	batchLimit := BodyLimit(app.MaxBatchBodySize())
+
+	api.Use(BodyLimit(app.MaxBodySize()))
+	api.POST("/login", h(LoginHandler))
+	api.POST("/logout", auth, h(LogoutHandler))
+	api.GET("/sessions", auth, h(ReadSessionsHandler))
+	api.DELETE("/sessions/:id", auth, h(RemoveSessionHandler))
+	api.POST("/users", h(NewUserHandler))
+	api.PUT("/account/name", auth, h(RenameUserHandler))
+	api.PUT("/account/password", auth, h(ChangePasswordHandler))
+	api.DELETE("/account", auth, h(RemoveUserHandler))
+	api.POST("/account/totp", auth, h(EnrollTOTPHandler))
+	api.POST("/account/totp/verify", auth, h(ConfirmTOTPHandler))
+	api.DELETE("/account/totp", auth, h(DisableTOTPHandler))
+	api.GET("/tokens", auth, h(ReadAPITokensHandler))
+	api.POST("/tokens", auth, h(NewAPITokenHandler))
+	api.DELETE("/tokens/:id", auth, h(RemoveAPITokenHandler))
+	api.GET("/admin/users", auth, admin, h(ReadUsersHandler))
+	api.PUT("/admin/users/:id/disabled", auth, admin, h(DisableUserHandler))
+	api.PUT("/admin/users/:id/password", auth, admin, h(ResetPasswordHandler))
+	api.PUT("/admin/users/:id/role", auth, admin, h(ChangeRoleHandler))
+	api.GET("/shares", auth, h(ReadSharesHandler))
+	api.POST("/shares", auth, h(NewShareHandler))
+	api.DELETE("/shares/:id", auth, h(RemoveShareHandler))
+	api.GET("/users/:id/series", apiAuth, h(ReadSeriesOfUserHandler))
+	api.GET("/next", apiAuth, h(ReadNextUpHandler))
+	api.POST("/series", apiAuth, h(NewSeriesHandler))
+	api.GET("/series/:id", apiAuth, h(ReadSeriesHandler))
+	api.PATCH("/series/:id", apiAuth, h(UpdateSeriesHandler))
+	api.DELETE("/series/:id", apiAuth, h(RemoveSeriesHandler))
+	api.GET("/series/:id/episodes", apiAuth, h(ReadEpisodesHandler))
+	api.POST("/series/:id/episodes", apiAuth, h(NewEpisodeHandler))
+	api.POST("/series/:id/episodes/batch", batchLimit, apiAuth, h(NewEpisodeBatchHandler))
+	api.GET("/series/:id/episodes/watched", apiAuth, h(ReadWatchedEpisodesHandler))
+	api.PUT("/episodes/:id/watched", apiAuth, h(WatchEpisodeHandler))
+	api.DELETE("/episodes/:id/watched", apiAuth, h(UnwatchEpisodeHandler))
+}
@@ -0,0 +1,340 @@
+package sj
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rrawrriw/angular-sauth-handler"
+)
+
+const (
+	DefaultSessionExpires = 24 * time.Hour
+	// AngularJS sends the value of this cookie in the X-XSRF-TOKEN header
+	XSRFCookieName = "XSRF-TOKEN"
+)
+
+var (
+	LoginError = NewAPIError(http.StatusUnauthorized, "login_failed", "Wrong name or password")
+)
+
+type (
+	// SessionData is a session without its token, the ID is the SHA-256
+	// of the token, see SessionID.
+	SessionData struct {
+		ID      string
+		Expires time.Time
+		Current bool
+	}
+
+	// LoginData is only sent to the client which owns the token
+	LoginData struct {
+		SessionData
+		Token string
+	}
+
+	SessionDataList []SessionData
+
+	// Code is the TOTP or a recovery code of users with two factors
+	LoginRequest struct {
+		User User
+		Code string
+	}
+
+	LoginBody struct {
+		UserBody
+		Code string
+	}
+)
+
+func (l SessionDataList) Len() int {
+	return len(l)
+}
+
+func (l SessionDataList) Less(x, y int) bool {
+	return l[x].Expires.Before(l[y].Expires)
+}
+
+func (l SessionDataList) Swap(x, y int) {
+	l[x], l[y] = l[y], l[x]
+}
+
+func NewSessionToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// SessionID identifies a session in lists and URLs, which are logged, so
+// the token itself is never sent back.
+func SessionID(token string) string {
+	return HashAPIToken(token)
+}
+
+func NewSessionData(s aauth.Session, current aauth.Session) SessionData {
+	return SessionData{
+		ID:      SessionID(s.Token),
+		Expires: s.Expires,
+		Current: s.Token == current.Token,
+	}
+}
+
+// RemoveExpiredSessions removes the expired sessions of the user and
+// returns the others.
+func RemoveExpiredSessions(store Store, userID string, now time.Time) ([]aauth.Session, error) {
+	sessions, err := store.ReadSessionsOfUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	live := []aauth.Session{}
+	for _, s := range sessions {
+		if !s.Expires.Before(now) {
+			live = append(live, s)
+			continue
+		}
+
+		err := store.RemoveSession(s.Token)
+		if err != nil && err != NotFoundError {
+			return nil, err
+		}
+	}
+
+	return live, nil
+}
+
+func SetXSRFCookie(c *gin.Context, session aauth.Session) {
+	cookie := &http.Cookie{
+		Name:    XSRFCookieName,
+		Value:   session.Token,
+		Path:    "/",
+		Expires: session.Expires,
+	}
+	http.SetCookie(c.Writer, cookie)
+}
+
+func RemoveXSRFCookie(c *gin.Context) {
+	cookie := &http.Cookie{
+		Name:   XSRFCookieName,
+		Value:  "",
+		Path:   "/",
+		MaxAge: -1,
+	}
+	http.SetCookie(c.Writer, cookie)
+}
+
+func ParseLoginRequest(r *http.Request) (LoginRequest, error) {
+	body, err := DecodeRequest[LoginBody](r)
+	if err != nil {
+		return LoginRequest{}, err
+	}
+
+	user, err := ParseUserBody(body.UserBody)
+	if err != nil {
+		return LoginRequest{}, err
+	}
+
+	login := LoginRequest{
+		User: user,
+		Code: body.Code,
+	}
+
+	return login, nil
+}
+
+func LoginHandler(c *gin.Context, app AppContext) error {
+	req, err := ParseLoginRequest(c.Request)
+	if err != nil {
+		return err
+	}
+	login := req.User
+
+	store := app.Store()
+	passwords := app.Passwords()
+	user, err := store.FindUser(login.Name)
+	if err == NotFoundError {
+		// Unknown names must not answer faster than wrong passwords
+		passwords.VerifyDummy(login.Pass)
+		return LoginError
+	}
+
+	if err != nil {
+		return err
+	}
+
+	ok, rehash, err := passwords.Verify(login.Pass, user.Password())
+	if err != nil && err != UnknownHashError {
+		return err
+	}
+
+	if !ok {
+		return LoginError
+	}
+
+	if user.Disabled {
+		return AccountDisabledError
+	}
+
+	err = CheckSecondFactor(store, user.Id, req.Code, app.Now())
+	if err != nil {
+		return err
+	}
+
+	// Upgrade old hashes, the login does not depend on it
+	if rehash {
+		hash, err := passwords.Hash(login.Pass)
+		if err == nil {
+			store.UpdateUser(user.Id, ChangeUser{Pass: hash})
+		}
+	}
+
+	token, err := NewSessionToken()
+	if err != nil {
+		return err
+	}
+
+	now := app.Now()
+	_, err = RemoveExpiredSessions(store, user.ID(), now)
+	if err != nil {
+		return err
+	}
+
+	session := aauth.Session{
+		Token:   token,
+		UserID:  user.ID(),
+		Expires: now.Add(app.SessionExpires()),
+	}
+	err = store.NewSession(session)
+	if err != nil {
+		return err
+	}
+
+	SetXSRFCookie(c, session)
+
+	data := LoginData{
+		SessionData: NewSessionData(session, session),
+		Token:       session.Token,
+	}
+	c.JSON(http.StatusOK, NewSuccessResponse(data))
+
+	return nil
+}
+
+// RemoveSessionsOfUser removes every session of the user except the one
+// with the keep token, an empty keep removes all.
+func RemoveSessionsOfUser(store Store, userID, keep string) error {
+	sessions, err := store.ReadSessionsOfUser(userID)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range sessions {
+		if keep != "" && s.Token == keep {
+			continue
+		}
+
+		err := store.RemoveSession(s.Token)
+		if err != nil && err != NotFoundError {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func LogoutHandler(c *gin.Context, app AppContext) error {
+	session, err := ReadAuthSession(c)
+	if err != nil {
+		return err
+	}
+
+	err = app.Store().RemoveSession(session.Token)
+	if err != nil {
+		return err
+	}
+
+	RemoveXSRFCookie(c)
+
+	data := NewSessionData(session, session)
+	c.JSON(http.StatusOK, NewSuccessResponse(data))
+
+	return nil
+}
+
+// Lists the sessions of the session user, expired ones are removed
+func ReadSessionsHandler(c *gin.Context, app AppContext) error {
+	session, err := ReadAuthSession(c)
+	if err != nil {
+		return err
+	}
+
+	sessions, err := RemoveExpiredSessions(app.Store(), session.UserID, app.Now())
+	if err != nil {
+		return err
+	}
+
+	data := SessionDataList{}
+	for _, s := range sessions {
+		data = append(data, NewSessionData(s, session))
+	}
+	sort.Sort(data)
+
+	c.JSON(http.StatusOK, NewSuccessResponse(data))
+
+	return nil
+}
+
+// Removes a session of the session user by its SessionID, the SHA-256 of
+// the token. The route is DELETE /sessions/:id instead of the requested
+// /sessions/:token, because the client only knows the IDs of the other
+// sessions and URLs are logged.
+func RemoveSessionHandler(c *gin.Context, app AppContext) error {
+	session, err := ReadAuthSession(c)
+	if err != nil {
+		return err
+	}
+
+	id := c.Params.ByName("id")
+	if id == "" {
+		return NewValidationError("Missing id parameter")
+	}
+
+	store := app.Store()
+	sessions, err := RemoveExpiredSessions(store, session.UserID, app.Now())
+	if err != nil {
+		return err
+	}
+
+	// Foreign sessions are never found
+	var found *aauth.Session
+	for i, s := range sessions {
+		if SessionID(s.Token) == id {
+			found = &sessions[i]
+			break
+		}
+	}
+
+	if found == nil {
+		return NewNotFoundError("Cannot find session")
+	}
+
+	err = store.RemoveSession(found.Token)
+	if err != nil {
+		return err
+	}
+
+	data := NewSessionData(*found, session)
+	if data.Current {
+		RemoveXSRFCookie(c)
+	}
+	c.JSON(http.StatusOK, NewSuccessResponse(data))
+
+	return nil
+}
@@ -0,0 +1,244 @@
+package sj
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rrawrriw/angular-sauth-handler"
+)
+
+type SessionsResponse struct {
+	Status string
+	Data   []SessionData
+}
+
+func Test_POST_Login_OK(t *testing.T) {
+	env := NewTestEnv(t)
+	defer env.Close()
+
+	env.NewUser("greatLover99", "secret")
+
+	body := `
+	{
+		"Data": {
+			"Name": "greatLover99",
+			"Password": "secret"
+		}
+	}`
+
+	req := env.Request(body)
+
+	resp := req.Send("POST", "/login")
+
+	login := struct {
+		Status string
+		Data   LoginData
+	}{}
+	err := json.Unmarshal(resp.Body.Bytes(), &login)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if login.Status != "success" || login.Data.Token == "" {
+		t.Fatal("Expect a session was", resp.Body)
+	}
+
+	cookie := resp.Header().Get("Set-Cookie")
+	if cookie == "" {
+		t.Fatal("Expect", XSRFCookieName, "cookie")
+	}
+
+	req = env.Request("")
+	resp = req.SendWithToken("GET", "/sessions", login.Data.Token)
+
+	sessions := SessionsResponse{}
+	err = json.Unmarshal(resp.Body.Bytes(), &sessions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sessions.Data) != 1 || !sessions.Data[0].Current {
+		t.Fatal("Expect the current session was", resp.Body)
+	}
+
+	if sessions.Data[0].ID != login.Data.ID || strings.Contains(resp.Body.String(), login.Data.Token) {
+		t.Fatal("Expect the session without its token was", resp.Body)
+	}
+
+	resp = req.SendWithToken("POST", "/logout", login.Data.Token)
+	if resp.Code != http.StatusOK {
+		t.Fatal("Expect", http.StatusOK, "was", resp.Code)
+	}
+
+	resp = req.SendWithToken("GET", "/sessions", login.Data.Token)
+	if resp.Code != http.StatusUnauthorized {
+		t.Fatal("Expect", http.StatusUnauthorized, "was", resp.Code)
+	}
+}
+
+func Test_POST_Login_FailWrongPassword(t *testing.T) {
+	env := NewTestEnv(t)
+	defer env.Close()
+
+	env.NewUser("greatLover99", "secret")
+
+	body := `
+	{
+		"Data": {
+			"Name": "greatLover99",
+			"Password": "wrong"
+		}
+	}`
+
+	req := env.Request(body)
+
+	resp := req.Send("POST", "/login")
+
+	expectResp := FailResponse{
+		Status: "fail",
+		Err:    LoginError.Error(),
+	}
+	err := EqualFailResponse(resp.Body, expectResp)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_POST_Login_RehashLegacyPassword(t *testing.T) {
+	env := NewTestEnv(t)
+	store := env.Store
+	defer env.Close()
+
+	// Users created before the PasswordHasher have SHA-512 hashes
+	user := User{
+		Name: "greatLover99",
+		Pass: aauth.NewSha512Password("secret"),
+	}
+	id, err := store.NewUser(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := `
+	{
+		"Data": {
+			"Name": "greatLover99",
+			"Password": "secret"
+		}
+	}`
+
+	req := env.Request(body)
+
+	resp := req.Send("POST", "/login")
+	if !strings.Contains(resp.Body.String(), "success") {
+		t.Fatal("Expect success was", resp.Body)
+	}
+
+	result, err := store.ReadUser(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	passwords := env.App.Passwords()
+	if !passwords.Hasher.Handles(result.Pass) {
+		t.Fatal("Expect a rehashed password was", result.Pass)
+	}
+
+	ok, rehash, err := passwords.Verify("secret", result.Pass)
+	if err != nil || !ok || rehash {
+		t.Fatal("Expect the new hash to match was", ok, rehash, err)
+	}
+}
+
+func Test_DELETE_Session_FailForeignSession(t *testing.T) {
+	env := NewTestEnv(t)
+	store := env.Store
+	defer env.Close()
+
+	_, session, _ := NewTestDBEnv(t, store)
+	foreign := NewTestSession("otherUser", "456", store, t)
+
+	req := env.Request("")
+
+	resp := req.SendWithToken("DELETE", "/sessions/"+SessionID(foreign.Token), session.Token)
+
+	expectResp := FailResponse{
+		Status: "fail",
+		Err:    "Cannot find session",
+	}
+	err := EqualFailResponse(resp.Body, expectResp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = store.ReadSession(foreign.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_DELETE_Session_OK(t *testing.T) {
+	env := NewTestEnv(t)
+	store := env.Store
+	defer env.Close()
+
+	user, session, _ := NewTestDBEnv(t, store)
+	// Not hex, so it cannot be part of the ID by chance
+	other := env.NewSession(user, "other-token")
+
+	req := env.Request("")
+
+	resp := req.SendWithToken("DELETE", "/sessions/"+SessionID(other.Token), session.Token)
+	if resp.Code != http.StatusOK || strings.Contains(resp.Body.String(), other.Token) {
+		t.Fatal("Expect the removed session without its token was", resp.Code, resp.Body)
+	}
+
+	_, err := store.ReadSession(other.Token)
+	if err != NotFoundError {
+		t.Fatal("Expect", NotFoundError, "was", err)
+	}
+
+	_, err = store.ReadSession(session.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_GET_Sessions_RemoveExpired(t *testing.T) {
+	env := NewTestEnv(t)
+	store := env.Store
+	defer env.Close()
+
+	user, session, _ := NewTestDBEnv(t, store)
+	expired := aauth.Session{
+		Token:   "456",
+		UserID:  user.Id.Hex(),
+		Expires: time.Now().Add(-time.Hour),
+	}
+	err := store.NewSession(expired)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := env.Request("")
+
+	resp := req.SendWithToken("GET", "/sessions", session.Token)
+
+	sessions := SessionsResponse{}
+	err = json.Unmarshal(resp.Body.Bytes(), &sessions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sessions.Data) != 1 || sessions.Data[0].ID != SessionID(session.Token) {
+		t.Fatal("Expect only the current session was", resp.Body)
+	}
+
+	_, err = store.ReadSession(expired.Token)
+	if err != NotFoundError {
+		t.Fatal("Expect", NotFoundError, "was", err)
+	}
+}
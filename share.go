@@ -0,0 +1,199 @@
+package sj
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	ShareExistsError = NewConflictError("share_exists", "Share already exists")
+	ShareSelfError   = NewValidationError("Cannot share with yourself")
+)
+
+type (
+	// Share allows the user to read the series of the owner
+	Share struct {
+		ID      bson.ObjectId `bson:"_id,omitempty"`
+		OwnerID bson.ObjectId `bson:"OwnerID"`
+		UserID  bson.ObjectId `bson:"UserID"`
+		Created time.Time     `bson:"Created"`
+	}
+
+	ShareData struct {
+		ID        string
+		OwnerID   string
+		OwnerName string
+		UserID    string
+		UserName  string
+		Created   time.Time
+	}
+
+	// Granted are the shares of the session user, Received the shares
+	// other users granted him.
+	SharesData struct {
+		Granted  []ShareData
+		Received []ShareData
+	}
+)
+
+func readShareData(store Store, shares []Share) ([]ShareData, error) {
+	data := []ShareData{}
+	for _, s := range shares {
+		owner, err := store.ReadUser(s.OwnerID)
+		if err != nil && err != NotFoundError {
+			return []ShareData{}, err
+		}
+
+		user, err := store.ReadUser(s.UserID)
+		if err != nil && err != NotFoundError {
+			return []ShareData{}, err
+		}
+
+		d := ShareData{
+			ID:        s.ID.Hex(),
+			OwnerID:   s.OwnerID.Hex(),
+			OwnerName: owner.Name,
+			UserID:    s.UserID.Hex(),
+			UserName:  user.Name,
+			Created:   s.Created,
+		}
+		data = append(data, d)
+	}
+
+	return data, nil
+}
+
+// Shares the series of the session user with the user of the name
+func NewShareHandler(c *gin.Context, app AppContext) error {
+	name, err := ParseNameRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	store := app.Store()
+	owner, err := ReadSessionUser(c, store)
+	if err != nil {
+		return err
+	}
+
+	user, err := store.FindUser(name)
+	if err == NotFoundError {
+		msg := fmt.Sprintf("Cannot find %v", name)
+		return NewNotFoundError(msg)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if user.Id == owner.Id {
+		return ShareSelfError
+	}
+
+	share := Share{
+		OwnerID: owner.Id,
+		UserID:  user.Id,
+		Created: app.Now(),
+	}
+	id, err := store.NewShare(share)
+	if err != nil {
+		return err
+	}
+
+	data := ShareData{
+		ID:        id.Hex(),
+		OwnerID:   owner.Id.Hex(),
+		OwnerName: owner.Name,
+		UserID:    user.Id.Hex(),
+		UserName:  user.Name,
+		Created:   share.Created,
+	}
+	c.JSON(http.StatusOK, NewSuccessResponse(data))
+
+	return nil
+}
+
+func ReadSharesHandler(c *gin.Context, app AppContext) error {
+	store := app.Store()
+	user, err := ReadSessionUser(c, store)
+	if err != nil {
+		return err
+	}
+
+	granted, err := store.ReadSharesOfOwner(user.Id)
+	if err != nil {
+		return err
+	}
+
+	received, err := store.ReadSharesWithUser(user.Id)
+	if err != nil {
+		return err
+	}
+
+	data := SharesData{}
+	data.Granted, err = readShareData(store, granted)
+	if err != nil {
+		return err
+	}
+
+	data.Received, err = readShareData(store, received)
+	if err != nil {
+		return err
+	}
+
+	c.JSON(http.StatusOK, NewSuccessResponse(data))
+
+	return nil
+}
+
+// The owner revokes a share, the user can leave it
+func RemoveShareHandler(c *gin.Context, app AppContext) error {
+	id, err := ParseIDParam(c, "id")
+	if err != nil {
+		return err
+	}
+
+	store := app.Store()
+	user, err := ReadSessionUser(c, store)
+	if err != nil {
+		return err
+	}
+
+	granted, err := store.ReadSharesOfOwner(user.Id)
+	if err != nil {
+		return err
+	}
+
+	received, err := store.ReadSharesWithUser(user.Id)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, s := range append(granted, received...) {
+		if s.ID == id {
+			found = true
+		}
+	}
+
+	if !found {
+		m := fmt.Sprintf("Cannot access %v", id.Hex())
+		return NewForbiddenError(m)
+	}
+
+	err = store.RemoveShare(id)
+	if err != nil {
+		return err
+	}
+
+	data := IDData{
+		ID: id.Hex(),
+	}
+	c.JSON(http.StatusOK, NewSuccessResponse(data))
+
+	return nil
+}
@@ -0,0 +1,120 @@
+package sj
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func Test_GET_SeriesOfUser_FailForeignUser(t *testing.T) {
+	env := NewTestEnv(t)
+	store := env.Store
+	defer env.Close()
+
+	owner, _, _ := NewTestDBEnv(t, store)
+
+	other := env.NewUser("otherLover", "secret")
+	session := env.NewSession(other, "456")
+
+	req := env.Request("")
+	resp := req.SendWithToken("GET", "/users/"+owner.Id.Hex()+"/series", session.Token)
+
+	if resp.Code != http.StatusForbidden {
+		t.Fatal("Expect", http.StatusForbidden, "was", resp.Code)
+	}
+
+	m := fmt.Sprintf("Cannot access %v", owner.Id.Hex())
+	err := EqualFailResponse(resp.Body, FailResponse{Status: "fail", Err: m})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_GET_SeriesOfUser_FailMissingSession(t *testing.T) {
+	env := NewTestEnv(t)
+	store := env.Store
+	defer env.Close()
+
+	owner, _, _ := NewTestDBEnv(t, store)
+
+	// Without SessionAuth the handler has to notice the missing session
+	handler := gin.New()
+	handler.GET("/users/:id/series", NewAppHandler(ReadSeriesOfUserHandler, env.App))
+
+	req := TestRequest{
+		Body:    "",
+		Header:  http.Header{},
+		Handler: handler,
+	}
+	resp := req.Send("GET", "/users/"+owner.Id.Hex()+"/series")
+
+	if resp.Code != http.StatusUnauthorized {
+		t.Fatal("Expect", http.StatusUnauthorized, "was", resp.Code)
+	}
+}
+
+func Test_GET_SeriesOfUser_Shared(t *testing.T) {
+	env := NewTestEnv(t)
+	store := env.Store
+	defer env.Close()
+
+	owner, ownerSession, sList := NewTestDBEnv(t, store)
+
+	other := env.NewUser("otherLover", "secret")
+	id := other.Id
+	session := env.NewSession(other, "456")
+
+	req := env.Request(`{"Data": {"Name": "otherLover"}}`)
+	resp := req.SendWithToken("POST", "/shares", ownerSession.Token)
+
+	share := struct {
+		Status string
+		Data   ShareData
+	}{}
+	err := json.Unmarshal(resp.Body.Bytes(), &share)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if share.Status != "success" || share.Data.UserID != id.Hex() {
+		t.Fatal("Expect a share was", resp.Body)
+	}
+
+	req = env.Request(`{"Data": {"Name": "otherLover"}}`)
+	resp = req.SendWithToken("POST", "/shares", ownerSession.Token)
+
+	err = EqualFailResponse(resp.Body, FailResponse{Status: "fail", Err: ShareExistsError.Error()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req = env.Request("")
+	resp = req.SendWithToken("GET", "/users/"+owner.Id.Hex()+"/series", session.Token)
+
+	expectResult := NewSuccessResponse(sList)
+	if !EqualSuccessResponse(expectResult, resp.Body, EqualSeriesList) {
+		t.Fatal("Expect", expectResult, "was", resp.Body)
+	}
+
+	// The share goes one way only
+	req = env.Request("")
+	resp = req.SendWithToken("GET", "/users/"+id.Hex()+"/series", ownerSession.Token)
+	if resp.Code != http.StatusForbidden {
+		t.Fatal("Expect", http.StatusForbidden, "was", resp.Code)
+	}
+
+	// The user leaves the share
+	req = env.Request("")
+	resp = req.SendWithToken("DELETE", "/shares/"+share.Data.ID, session.Token)
+	if resp.Code != http.StatusOK {
+		t.Fatal("Expect", http.StatusOK, "was", resp.Code, resp.Body)
+	}
+
+	resp = req.SendWithToken("GET", "/users/"+owner.Id.Hex()+"/series", session.Token)
+	if resp.Code != http.StatusForbidden {
+		t.Fatal("Expect", http.StatusForbidden, "was", resp.Code)
+	}
+}
@@ -0,0 +1,294 @@
+package sj
+
+import (
+	"database/sql"
+	"time"
+)
+
+type (
+	// SQLMigration is one step of the SQLite schema. Versions must be
+	// unique and must never change once they have been released, new
+	// schema changes always get a new version.
+	SQLMigration struct {
+		Version int
+		Stmts   []string
+	}
+)
+
+var SQLiteMigrations = []SQLMigration{
+	{
+		Version: 1,
+		Stmts: []string{
+			`CREATE TABLE series (
+				id            TEXT PRIMARY KEY,
+				title         TEXT NOT NULL,
+				image_name    TEXT NOT NULL,
+				image_url     TEXT NOT NULL,
+				episodes_name TEXT NOT NULL,
+				episodes_url  TEXT NOT NULL,
+				desc_name     TEXT NOT NULL,
+				desc_url      TEXT NOT NULL,
+				portal_name   TEXT NOT NULL,
+				portal_url    TEXT NOT NULL
+			)`,
+			`CREATE TABLE users (
+				id       TEXT PRIMARY KEY,
+				name     TEXT NOT NULL,
+				password TEXT NOT NULL
+			)`,
+			// Keeps the order and the duplicates of User.Series
+			`CREATE TABLE user_series (
+				user_id   TEXT NOT NULL,
+				position  INTEGER NOT NULL,
+				series_id TEXT NOT NULL,
+				PRIMARY KEY (user_id, position)
+			)`,
+			`CREATE TABLE episodes (
+				id        TEXT PRIMARY KEY,
+				series_id TEXT NOT NULL,
+				title     TEXT NOT NULL,
+				session   INTEGER NOT NULL,
+				episode   INTEGER NOT NULL,
+				watched   INTEGER NOT NULL DEFAULT 0
+			)`,
+			`CREATE INDEX episodes_series_id ON episodes (series_id)`,
+			`CREATE TABLE sessions (
+				token   TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL,
+				expires INTEGER NOT NULL
+			)`,
+		},
+	},
+	{
+		Version: 2,
+		Stmts: []string{
+			`CREATE TABLE watch_records (
+				id         TEXT PRIMARY KEY,
+				user_id    TEXT NOT NULL,
+				series_id  TEXT NOT NULL,
+				episode_id TEXT NOT NULL,
+				watched    INTEGER NOT NULL,
+				UNIQUE (user_id, episode_id)
+			)`,
+			`CREATE INDEX watch_records_user_series ON watch_records (user_id, series_id)`,
+			// The old flag was visible to every user following the
+			// series, so every one of them gets a record.
+			`INSERT INTO watch_records (id, user_id, series_id, episode_id, watched)
+			SELECT lower(hex(randomblob(12))), u.user_id, e.series_id, e.id,
+				CAST(strftime('%s', 'now') AS INTEGER) * 1000000000
+			FROM episodes e
+			JOIN (SELECT DISTINCT user_id, series_id FROM user_series) u
+				ON u.series_id = e.series_id
+			WHERE e.watched = 1`,
+			`ALTER TABLE episodes DROP COLUMN watched`,
+		},
+	},
+	{
+		Version: 3,
+		Stmts: []string{
+			// Every resource field of a series becomes a list
+			`CREATE TABLE series_resources (
+				series_id TEXT NOT NULL,
+				field     TEXT NOT NULL,
+				position  INTEGER NOT NULL,
+				name      TEXT NOT NULL,
+				url       TEXT NOT NULL,
+				PRIMARY KEY (series_id, field, position)
+			)`,
+			`INSERT INTO series_resources (series_id, field, position, name, url)
+			SELECT id, 'Image', 1, image_name, image_url FROM series
+			WHERE image_name != '' OR image_url != ''`,
+			`INSERT INTO series_resources (series_id, field, position, name, url)
+			SELECT id, 'Episodes', 1, episodes_name, episodes_url FROM series
+			WHERE episodes_name != '' OR episodes_url != ''`,
+			`INSERT INTO series_resources (series_id, field, position, name, url)
+			SELECT id, 'Desc', 1, desc_name, desc_url FROM series
+			WHERE desc_name != '' OR desc_url != ''`,
+			`INSERT INTO series_resources (series_id, field, position, name, url)
+			SELECT id, 'Portal', 1, portal_name, portal_url FROM series
+			WHERE portal_name != '' OR portal_url != ''`,
+			`ALTER TABLE series DROP COLUMN image_name`,
+			`ALTER TABLE series DROP COLUMN image_url`,
+			`ALTER TABLE series DROP COLUMN episodes_name`,
+			`ALTER TABLE series DROP COLUMN episodes_url`,
+			`ALTER TABLE series DROP COLUMN desc_name`,
+			`ALTER TABLE series DROP COLUMN desc_url`,
+			`ALTER TABLE series DROP COLUMN portal_name`,
+			`ALTER TABLE series DROP COLUMN portal_url`,
+		},
+	},
+	{
+		Version: 4,
+		Stmts: []string{
+			`CREATE TABLE journal (
+				id        TEXT PRIMARY KEY,
+				op        TEXT NOT NULL,
+				user_id   TEXT NOT NULL,
+				series_id TEXT NOT NULL,
+				created   INTEGER NOT NULL
+			)`,
+		},
+	},
+	{
+		Version: 5,
+		Stmts: []string{
+			`CREATE UNIQUE INDEX users_name ON users (name)`,
+		},
+	},
+	{
+		Version: 6,
+		Stmts: []string{
+			`CREATE TABLE api_tokens (
+				id      TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL,
+				name    TEXT NOT NULL,
+				hash    TEXT NOT NULL UNIQUE,
+				scope   TEXT NOT NULL,
+				created INTEGER NOT NULL,
+				expires INTEGER NOT NULL
+			)`,
+			`CREATE INDEX api_tokens_user_id ON api_tokens (user_id)`,
+		},
+	},
+	{
+		Version: 7,
+		Stmts: []string{
+			`CREATE TABLE totp (
+				user_id        TEXT PRIMARY KEY,
+				secret         TEXT NOT NULL,
+				enabled        INTEGER NOT NULL,
+				recovery_codes TEXT NOT NULL,
+				last_step      INTEGER NOT NULL
+			)`,
+		},
+	},
+	{
+		Version: 8,
+		Stmts: []string{
+			`ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE users ADD COLUMN disabled INTEGER NOT NULL DEFAULT 0`,
+		},
+	},
+	{
+		Version: 9,
+		Stmts: []string{
+			`CREATE TABLE shares (
+				id       TEXT PRIMARY KEY,
+				owner_id TEXT NOT NULL,
+				user_id  TEXT NOT NULL,
+				created  INTEGER NOT NULL,
+				UNIQUE (owner_id, user_id)
+			)`,
+			`CREATE INDEX shares_user_id ON shares (user_id)`,
+		},
+	},
+	{
+		Version: 10,
+		Stmts: []string{
+			`ALTER TABLE series ADD COLUMN episode_order TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE episodes ADD COLUMN part INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE episodes ADD COLUMN absolute INTEGER NOT NULL DEFAULT 0`,
+			// Unix nanoseconds, 0 if unknown
+			`ALTER TABLE episodes ADD COLUMN aired INTEGER NOT NULL DEFAULT 0`,
+		},
+	},
+	{
+		Version: 11,
+		Stmts: []string{
+			`ALTER TABLE totp ADD COLUMN failures INTEGER NOT NULL DEFAULT 0`,
+			// Unix nanoseconds, 0 without failures
+			`ALTER TABLE totp ADD COLUMN last_failure INTEGER NOT NULL DEFAULT 0`,
+		},
+	},
+	{
+		Version: 12,
+		Stmts: []string{
+			`ALTER TABLE series ADD COLUMN owner_id TEXT NOT NULL DEFAULT ''`,
+			// The IDs start with the creation time, the first user who
+			// followed the series most likely created it
+			`UPDATE series SET owner_id = (
+				SELECT MIN(user_id) FROM user_series
+				WHERE user_series.series_id = series.id
+			) WHERE id IN (SELECT series_id FROM user_series)`,
+		},
+	},
+	{
+		Version: 13,
+		Stmts: []string{
+			// Fails as long as two names differ only in case, like
+			// migrateUserNameCase of MongoDB
+			`DROP INDEX users_name`,
+			`CREATE UNIQUE INDEX users_name ON users (name COLLATE NOCASE)`,
+		},
+	},
+}
+
+func schemaVersion(db *sql.DB) (int, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		applied INTEGER NOT NULL
+	)`)
+	if err != nil {
+		return 0, err
+	}
+
+	version := 0
+	row := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`)
+	err = row.Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+
+	return version, nil
+}
+
+func applyMigration(db *sql.DB, m SQLMigration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	for _, stmt := range m.Stmts {
+		_, err := tx.Exec(stmt)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO schema_migrations (version, applied) VALUES (?, ?)`,
+		m.Version,
+		time.Now().Unix(),
+	)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// MigrateSQL brings the schema up to the newest version. Every migration
+// runs in its own transaction, so a failed migration leaves the database
+// at the last successful version.
+func MigrateSQL(db *sql.DB, migrations []SQLMigration) error {
+	version, err := schemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.Version <= version {
+			continue
+		}
+
+		err := applyMigration(db, m)
+		if err != nil {
+			return err
+		}
+		version = m.Version
+	}
+
+	return nil
+}
@@ -0,0 +1,130 @@
+package sj
+
+import (
+	"database/sql"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func Test_MigrateSQL_OK(t *testing.T) {
+	store, err := NewSQLiteStore(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	latest := SQLiteMigrations[len(SQLiteMigrations)-1].Version
+
+	version, err := schemaVersion(store.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version != latest {
+		t.Fatal("Expect", latest, "was", version)
+	}
+
+	// A second run must not apply anything again
+	err = MigrateSQL(store.DB, SQLiteMigrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	version, err = schemaVersion(store.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version != latest {
+		t.Fatal("Expect", latest, "was", version)
+	}
+}
+
+// The data of a v1 database survives the migrations, the watched flags
+// become watch records (v2) and the resource columns resources (v3)
+func Test_MigrateSQL_OKV1Data(t *testing.T) {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SetMaxOpenConns(1)
+	store := &SQLiteStore{DB: db}
+	defer store.Close()
+
+	err = MigrateSQL(db, SQLiteMigrations[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seriesID := bson.NewObjectId()
+	userIDs := []bson.ObjectId{bson.NewObjectId(), bson.NewObjectId()}
+	watchedID := bson.NewObjectId()
+	stmts := []struct {
+		Query string
+		Args  []interface{}
+	}{
+		{
+			`INSERT INTO series VALUES (?, 'Narcos', 'kinox.to', 'http://kinox.to/Narcos.html', '', '', 'imdb.com', 'http://www.imdb.com/title/tt2707408', '', '')`,
+			[]interface{}{seriesID.Hex()},
+		},
+		{`INSERT INTO users VALUES (?, 'greatLover99', 'hash')`, []interface{}{userIDs[0].Hex()}},
+		{`INSERT INTO users VALUES (?, 'otherLover', 'hash')`, []interface{}{userIDs[1].Hex()}},
+		{`INSERT INTO user_series VALUES (?, 0, ?)`, []interface{}{userIDs[0].Hex(), seriesID.Hex()}},
+		{`INSERT INTO user_series VALUES (?, 0, ?)`, []interface{}{userIDs[1].Hex(), seriesID.Hex()}},
+		{
+			`INSERT INTO episodes VALUES (?, ?, 'Descenso', 1, 1, 1)`,
+			[]interface{}{watchedID.Hex(), seriesID.Hex()},
+		},
+		{
+			`INSERT INTO episodes VALUES (?, ?, 'The Sword of Simón Bolívar', 1, 2, 0)`,
+			[]interface{}{bson.NewObjectId().Hex(), seriesID.Hex()},
+		},
+	}
+	for _, s := range stmts {
+		_, err := db.Exec(s.Query, s.Args...)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = MigrateSQL(db, SQLiteMigrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, userID := range userIDs {
+		watched, err := store.ReadWatchedEpisodes(userID, seriesID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(watched) != 1 || watched[0].ID != watchedID {
+			t.Fatal("Expect", watchedID, "to be watched was", watched)
+		}
+	}
+
+	series, err := store.ReadSeries(seriesID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	image := Resource{Name: "kinox.to", URL: "http://kinox.to/Narcos.html"}
+	desc := Resource{Name: "imdb.com", URL: "http://www.imdb.com/title/tt2707408"}
+	if len(series.Image) != 1 || series.Image[0] != image {
+		t.Fatal("Expect", image, "was", series.Image)
+	}
+
+	if len(series.Desc) != 1 || series.Desc[0] != desc {
+		t.Fatal("Expect", desc, "was", series.Desc)
+	}
+
+	if len(series.Episodes) != 0 || len(series.Portal) != 0 {
+		t.Fatal("Expect no episodes and portal resources was", series)
+	}
+
+	// The older of both followers
+	if series.Owner != userIDs[0] {
+		t.Fatal("Expect the owner", userIDs[0], "was", series.Owner)
+	}
+}
@@ -0,0 +1,1397 @@
+package sj
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rrawrriw/angular-sauth-handler"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+type (
+	// SQLiteStore implements Store on top of an embedded SQLite database.
+	// The IDs are still bson.ObjectIds, stored as hex strings.
+	SQLiteStore struct {
+		DB *sql.DB
+	}
+
+	sqlScanner interface {
+		Scan(dest ...interface{}) error
+	}
+
+	sqlExecer interface {
+		Exec(query string, args ...interface{}) (sql.Result, error)
+	}
+)
+
+const (
+	seriesColumns   = `id, title, episode_order, owner_id`
+	userColumns     = `id, name, password, role, disabled`
+	episodeColumns  = `id, series_id, title, session, episode, part, absolute, aired`
+	apiTokenColumns = `id, user_id, name, hash, scope, created, expires`
+	shareColumns    = `id, owner_id, user_id, created`
+)
+
+func NewSQLiteStore(dsn string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows only one writer, a single connection also keeps
+	// ":memory:" databases alive between calls.
+	db.SetMaxOpenConns(1)
+
+	err = MigrateSQL(db, SQLiteMigrations)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLiteStore{DB: db}, nil
+}
+
+func sqlError(err error) error {
+	if err == sql.ErrNoRows {
+		return NotFoundError
+	}
+
+	return err
+}
+
+// sqlUniqueError reports a violated UNIQUE constraint by the extended
+// result code of the driver, primary keys have their own code.
+func sqlUniqueError(err error) bool {
+	var e *sqlite.Error
+	return errors.As(err, &e) && e.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
+
+// users.name is the only UNIQUE column the writes of a user can violate
+func sqlUserError(err error) error {
+	if sqlUniqueError(err) {
+		return UserExistsError
+	}
+
+	return err
+}
+
+func sqlPlaceholders(n int) string {
+	if n == 0 {
+		return ""
+	}
+
+	return strings.Repeat("?, ", n-1) + "?"
+}
+
+func hexIDs(ids []bson.ObjectId) []interface{} {
+	args := []interface{}{}
+	for _, id := range ids {
+		args = append(args, id.Hex())
+	}
+
+	return args
+}
+
+func expectAffected(r sql.Result) error {
+	n, err := r.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return NotFoundError
+	}
+
+	return nil
+}
+
+func scanSeries(row sqlScanner) (Series, error) {
+	var id, owner string
+	s := Series{}
+	err := row.Scan(&id, &s.Title, &s.Order, &owner)
+	if err != nil {
+		return Series{}, err
+	}
+	s.ID = bson.ObjectIdHex(id)
+	if owner != "" {
+		s.Owner = bson.ObjectIdHex(owner)
+	}
+
+	return NormalizeSeries(s), nil
+}
+
+func seriesResources(series *Series, field string) *Resources {
+	switch field {
+	case "Image":
+		return &series.Image
+	case "Episodes":
+		return &series.Episodes
+	case "Desc":
+		return &series.Desc
+	case "Portal":
+		return &series.Portal
+	}
+
+	return nil
+}
+
+// Loads the resource lists of all given series with one query.
+func (s *SQLiteStore) readResources(list []Series) error {
+	if len(list) == 0 {
+		return nil
+	}
+
+	index := map[string]*Series{}
+	ids := []bson.ObjectId{}
+	for i := range list {
+		index[list[i].ID.Hex()] = &list[i]
+		ids = append(ids, list[i].ID)
+	}
+
+	rows, err := s.DB.Query(
+		`SELECT series_id, field, name, url FROM series_resources
+		WHERE series_id IN (`+sqlPlaceholders(len(ids))+`)
+		ORDER BY series_id, field, position`,
+		hexIDs(ids)...,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var seriesID, field string
+		r := Resource{}
+		err := rows.Scan(&seriesID, &field, &r.Name, &r.URL)
+		if err != nil {
+			return err
+		}
+
+		series, ok := index[seriesID]
+		if !ok {
+			continue
+		}
+
+		l := seriesResources(series, field)
+		if l != nil {
+			*l = append(*l, r)
+		}
+	}
+
+	return rows.Err()
+}
+
+func appendResources(tx sqlExecer, seriesID bson.ObjectId, field string, l []Resource) error {
+	for _, r := range l {
+		_, err := tx.Exec(
+			`INSERT INTO series_resources (series_id, field, position, name, url)
+			SELECT ?, ?, COALESCE(MAX(position), 0) + 1, ?, ?
+			FROM series_resources WHERE series_id = ? AND field = ?`,
+			seriesID.Hex(),
+			field,
+			r.Name,
+			r.URL,
+			seriesID.Hex(),
+			field,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func removeResources(tx sqlExecer, seriesID bson.ObjectId, field string, l []Resource) error {
+	for _, r := range l {
+		_, err := tx.Exec(
+			`DELETE FROM series_resources
+			WHERE series_id = ? AND field = ? AND name = ? AND url = ?`,
+			seriesID.Hex(),
+			field,
+			r.Name,
+			r.URL,
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func replaceResources(tx sqlExecer, seriesID bson.ObjectId, field string, l []Resource) error {
+	_, err := tx.Exec(
+		`DELETE FROM series_resources WHERE series_id = ? AND field = ?`,
+		seriesID.Hex(),
+		field,
+	)
+	if err != nil {
+		return err
+	}
+
+	return appendResources(tx, seriesID, field, l)
+}
+
+func scanEpisode(row sqlScanner) (Episode, error) {
+	var id, seriesID string
+	var aired int64
+	e := Episode{}
+	err := row.Scan(&id, &seriesID, &e.Title, &e.Session, &e.Episode, &e.Part, &e.Absolute, &aired)
+	if err != nil {
+		return Episode{}, err
+	}
+	e.ID = bson.ObjectIdHex(id)
+	e.SeriesID = bson.ObjectIdHex(seriesID)
+	e.Aired = sqlReadTime(aired)
+
+	return e, nil
+}
+
+func (s *SQLiteStore) NewSeries(series Series) (bson.ObjectId, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return bson.ObjectId(""), err
+	}
+
+	id := series.ID
+	if id == "" {
+		id = bson.NewObjectId()
+	}
+
+	_, err = tx.Exec(
+		`INSERT INTO series (`+seriesColumns+`) VALUES (?, ?, ?, ?)`,
+		id.Hex(),
+		series.Title,
+		series.Order,
+		series.Owner.Hex(),
+	)
+	if err != nil {
+		tx.Rollback()
+		return bson.ObjectId(""), err
+	}
+
+	for field, l := range series.ResourceFields() {
+		err := appendResources(tx, id, field, l)
+		if err != nil {
+			tx.Rollback()
+			return bson.ObjectId(""), err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return bson.ObjectId(""), err
+	}
+
+	return id, nil
+}
+
+func (s *SQLiteStore) ReadSeries(id bson.ObjectId) (Series, error) {
+	row := s.DB.QueryRow(`SELECT `+seriesColumns+` FROM series WHERE id = ?`, id.Hex())
+	series, err := scanSeries(row)
+	if err != nil {
+		return Series{}, sqlError(err)
+	}
+
+	list := []Series{series}
+	err = s.readResources(list)
+	if err != nil {
+		return Series{}, err
+	}
+
+	return list[0], nil
+}
+
+func (s *SQLiteStore) ReadAllSeries(ids []bson.ObjectId) ([]Series, error) {
+	resultList := SeriesList{}
+	if len(ids) == 0 {
+		return resultList, nil
+	}
+
+	rows, err := s.DB.Query(
+		`SELECT `+seriesColumns+` FROM series WHERE id IN (`+sqlPlaceholders(len(ids))+`)`,
+		hexIDs(ids)...,
+	)
+	if err != nil {
+		return []Series{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		series, err := scanSeries(rows)
+		if err != nil {
+			return []Series{}, err
+		}
+		resultList = append(resultList, series)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return []Series{}, err
+	}
+
+	err = s.readResources(resultList)
+	if err != nil {
+		return []Series{}, err
+	}
+	sort.Sort(resultList)
+
+	return resultList, nil
+}
+
+func (s *SQLiteStore) UpdateSeries(id bson.ObjectId, change ChangeSeries) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	var n int
+	row := tx.QueryRow(`SELECT COUNT(*) FROM series WHERE id = ?`, id.Hex())
+	err = row.Scan(&n)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if n == 0 {
+		tx.Rollback()
+		return NotFoundError
+	}
+
+	if change.Title != "" {
+		_, err := tx.Exec(`UPDATE series SET title = ? WHERE id = ?`, change.Title, id.Hex())
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if change.Order != "" {
+		_, err := tx.Exec(`UPDATE series SET episode_order = ? WHERE id = ?`, change.Order, id.Hex())
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	for field, v := range change.Fields() {
+		var err error
+		switch items := v.(type) {
+		case AppendResources:
+			err = appendResources(tx, id, field, items)
+		case RemoveResources:
+			err = removeResources(tx, id, field, items)
+		case Resources:
+			err = replaceResources(tx, id, field, items)
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *SQLiteStore) RemoveSeries(id bson.ObjectId) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM user_series WHERE series_id = ?`, id.Hex())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = removeSQLSeriesData(tx, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Removes the series with its resources, episodes and watch records
+func removeSQLSeriesData(tx sqlExecer, id bson.ObjectId) error {
+	stmts := []string{
+		`DELETE FROM watch_records WHERE series_id = ?`,
+		`DELETE FROM episodes WHERE series_id = ?`,
+		`DELETE FROM series_resources WHERE series_id = ?`,
+	}
+	for _, stmt := range stmts {
+		_, err := tx.Exec(stmt, id.Hex())
+		if err != nil {
+			return err
+		}
+	}
+
+	result, err := tx.Exec(`DELETE FROM series WHERE id = ?`, id.Hex())
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(result)
+}
+
+func (s *SQLiteStore) RemoveSeriesOfUser(userID, seriesID bson.ObjectId) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	var n int
+	row := tx.QueryRow(`SELECT COUNT(*) FROM users WHERE id = ?`, userID.Hex())
+	err = row.Scan(&n)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if n == 0 {
+		tx.Rollback()
+		return NotFoundError
+	}
+
+	_, err = tx.Exec(
+		`DELETE FROM user_series WHERE user_id = ? AND series_id = ?`,
+		userID.Hex(),
+		seriesID.Hex(),
+	)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	_, err = tx.Exec(
+		`DELETE FROM watch_records WHERE user_id = ? AND series_id = ?`,
+		userID.Hex(),
+		seriesID.Hex(),
+	)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	row = tx.QueryRow(`SELECT COUNT(*) FROM user_series WHERE series_id = ?`, seriesID.Hex())
+	err = row.Scan(&n)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	// NotFoundError means the series was already removed
+	if n == 0 {
+		err = removeSQLSeriesData(tx, seriesID)
+		if err != nil && err != NotFoundError {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func appendUserSeries(tx sqlExecer, userID bson.ObjectId, ids []bson.ObjectId) error {
+	for _, id := range ids {
+		_, err := tx.Exec(
+			`INSERT INTO user_series (user_id, position, series_id)
+			SELECT ?, COALESCE(MAX(position), 0) + 1, ?
+			FROM user_series WHERE user_id = ?`,
+			userID.Hex(),
+			id.Hex(),
+			userID.Hex(),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *SQLiteStore) NewUser(user User) (bson.ObjectId, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return bson.ObjectId(""), err
+	}
+
+	id := bson.NewObjectId()
+	_, err = tx.Exec(
+		`INSERT INTO users (`+userColumns+`) VALUES (?, ?, ?, ?, ?)`,
+		id.Hex(),
+		user.Name,
+		user.Pass,
+		user.Role,
+		sqlBool(user.Disabled),
+	)
+	if err != nil {
+		tx.Rollback()
+		return bson.ObjectId(""), sqlUserError(err)
+	}
+
+	err = appendUserSeries(tx, id, user.Series)
+	if err != nil {
+		tx.Rollback()
+		return bson.ObjectId(""), err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return bson.ObjectId(""), err
+	}
+
+	return id, nil
+}
+
+func (s *SQLiteStore) readUserSeries(id bson.ObjectId) ([]bson.ObjectId, error) {
+	rows, err := s.DB.Query(
+		`SELECT series_id FROM user_series WHERE user_id = ? ORDER BY position`,
+		id.Hex(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []bson.ObjectId{}
+	for rows.Next() {
+		var seriesID string
+		err := rows.Scan(&seriesID)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, bson.ObjectIdHex(seriesID))
+	}
+
+	return ids, rows.Err()
+}
+
+func sqlBool(b bool) int {
+	if b {
+		return 1
+	}
+
+	return 0
+}
+
+func scanUser(row sqlScanner) (User, error) {
+	var id string
+	var disabled int
+	user := User{}
+	err := row.Scan(&id, &user.Name, &user.Pass, &user.Role, &disabled)
+	if err != nil {
+		return User{}, err
+	}
+	user.Id = bson.ObjectIdHex(id)
+	user.Disabled = disabled == 1
+
+	return user, nil
+}
+
+func (s *SQLiteStore) readUser(where string, arg interface{}) (User, error) {
+	row := s.DB.QueryRow(`SELECT `+userColumns+` FROM users WHERE `+where, arg)
+	user, err := scanUser(row)
+	if err != nil {
+		return User{}, sqlError(err)
+	}
+
+	user.Series, err = s.readUserSeries(user.Id)
+	if err != nil {
+		return User{}, err
+	}
+
+	return user, nil
+}
+
+func (s *SQLiteStore) ReadUser(id bson.ObjectId) (User, error) {
+	return s.readUser("id = ?", id.Hex())
+}
+
+func (s *SQLiteStore) FindUser(name string) (User, error) {
+	return s.readUser("name = ?", name)
+}
+
+func (s *SQLiteStore) ReadUsers() ([]User, error) {
+	rows, err := s.DB.Query(`SELECT ` + userColumns + ` FROM users ORDER BY name`)
+	if err != nil {
+		return []User{}, err
+	}
+
+	users := []User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			rows.Close()
+			return []User{}, err
+		}
+		users = append(users, user)
+	}
+	rows.Close()
+
+	err = rows.Err()
+	if err != nil {
+		return []User{}, err
+	}
+
+	// The store has a single connection, the rows have to be closed
+	// before the series are read.
+	for i := range users {
+		users[i].Series, err = s.readUserSeries(users[i].Id)
+		if err != nil {
+			return []User{}, err
+		}
+	}
+
+	return users, nil
+}
+
+func (s *SQLiteStore) ReadSeriesOfUser(id bson.ObjectId) ([]Series, error) {
+	user, err := s.ReadUser(id)
+	if err != nil {
+		return []Series{}, err
+	}
+
+	return s.ReadAllSeries(user.Series)
+}
+
+func (s *SQLiteStore) UpdateUser(id bson.ObjectId, change ChangeUser) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	err = updateUser(tx, id, change)
+	if err != nil {
+		tx.Rollback()
+		return sqlUserError(err)
+	}
+
+	return tx.Commit()
+}
+
+func updateUser(tx *sql.Tx, id bson.ObjectId, change ChangeUser) error {
+	var exists int
+	err := tx.QueryRow(`SELECT COUNT(*) FROM users WHERE id = ?`, id.Hex()).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if exists == 0 {
+		return NotFoundError
+	}
+
+	if change.Name != "" {
+		_, err := tx.Exec(`UPDATE users SET name = ? WHERE id = ?`, change.Name, id.Hex())
+		if err != nil {
+			return err
+		}
+	}
+
+	if change.Pass != "" {
+		_, err := tx.Exec(`UPDATE users SET password = ? WHERE id = ?`, change.Pass, id.Hex())
+		if err != nil {
+			return err
+		}
+	}
+
+	if change.Role != "" {
+		_, err := tx.Exec(`UPDATE users SET role = ? WHERE id = ?`, change.Role, id.Hex())
+		if err != nil {
+			return err
+		}
+	}
+
+	if change.Disabled != nil {
+		disabled := sqlBool(*change.Disabled)
+		_, err := tx.Exec(`UPDATE users SET disabled = ? WHERE id = ?`, disabled, id.Hex())
+		if err != nil {
+			return err
+		}
+	}
+
+	switch items := change.Series.(type) {
+	case AppendIDItems:
+		return appendUserSeries(tx, id, items)
+	case RemoveIDItems:
+		if len(items) == 0 {
+			return nil
+		}
+		args := append([]interface{}{id.Hex()}, hexIDs(items)...)
+		_, err := tx.Exec(
+			`DELETE FROM user_series WHERE user_id = ? AND series_id IN (`+sqlPlaceholders(len(items))+`)`,
+			args...,
+		)
+		return err
+	case []bson.ObjectId:
+		_, err := tx.Exec(`DELETE FROM user_series WHERE user_id = ?`, id.Hex())
+		if err != nil {
+			return err
+		}
+		return appendUserSeries(tx, id, items)
+	}
+
+	return nil
+}
+
+func (s *SQLiteStore) RemoveUser(id bson.ObjectId) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM user_series WHERE user_id = ?`, id.Hex())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	result, err := tx.Exec(`DELETE FROM users WHERE id = ?`, id.Hex())
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	err = expectAffected(result)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func insertEpisode(tx sqlExecer, episode Episode) error {
+	_, err := tx.Exec(
+		`INSERT INTO episodes (`+episodeColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		episode.ID.Hex(),
+		episode.SeriesID.Hex(),
+		episode.Title,
+		episode.Session,
+		episode.Episode,
+		episode.Part,
+		episode.Absolute,
+		sqlTime(episode.Aired),
+	)
+
+	return err
+}
+
+func (s *SQLiteStore) NewEpisode(episode Episode) (bson.ObjectId, error) {
+	id := bson.NewObjectId()
+	episode.ID = id
+
+	err := insertEpisode(s.DB, episode)
+	if err != nil {
+		return bson.ObjectId(""), err
+	}
+
+	return id, nil
+}
+
+func (s *SQLiteStore) NewEpisodeBatch(episodes []Episode) ([]bson.ObjectId, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return []bson.ObjectId{}, err
+	}
+
+	ids := []bson.ObjectId{}
+	for _, e := range episodes {
+		id := bson.NewObjectId()
+		e.ID = id
+		ids = append(ids, id)
+
+		err := insertEpisode(tx, e)
+		if err != nil {
+			tx.Rollback()
+			return []bson.ObjectId{}, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return []bson.ObjectId{}, err
+	}
+
+	return ids, nil
+}
+
+func (s *SQLiteStore) ReadEpisode(id bson.ObjectId) (Episode, error) {
+	row := s.DB.QueryRow(`SELECT `+episodeColumns+` FROM episodes WHERE id = ?`, id.Hex())
+	episode, err := scanEpisode(row)
+	if err != nil {
+		return Episode{}, sqlError(err)
+	}
+
+	return episode, nil
+}
+
+func (s *SQLiteStore) queryEpisodes(query string, args ...interface{}) (Episodes, error) {
+	rows, err := s.DB.Query(query, args...)
+	if err != nil {
+		return Episodes{}, err
+	}
+	defer rows.Close()
+
+	result := Episodes{}
+	for rows.Next() {
+		e, err := scanEpisode(rows)
+		if err != nil {
+			return Episodes{}, err
+		}
+		result = append(result, e)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return Episodes{}, err
+	}
+
+	return result, nil
+}
+
+func (s *SQLiteStore) ReadEpisodes(seriesID bson.ObjectId) ([]Episode, error) {
+	return s.queryEpisodes(
+		`SELECT `+episodeColumns+` FROM episodes WHERE series_id = ? ORDER BY rowid`,
+		seriesID.Hex(),
+	)
+}
+
+func (s *SQLiteStore) WatchEpisode(userID, id bson.ObjectId) error {
+	episode, err := s.ReadEpisode(id)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.DB.Exec(
+		`INSERT INTO watch_records (id, user_id, series_id, episode_id, watched)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (user_id, episode_id) DO UPDATE SET watched = excluded.watched`,
+		bson.NewObjectId().Hex(),
+		userID.Hex(),
+		episode.SeriesID.Hex(),
+		id.Hex(),
+		time.Now().UnixNano(),
+	)
+
+	return err
+}
+
+func (s *SQLiteStore) UnwatchEpisode(userID, id bson.ObjectId) error {
+	result, err := s.DB.Exec(
+		`DELETE FROM watch_records WHERE user_id = ? AND episode_id = ?`,
+		userID.Hex(),
+		id.Hex(),
+	)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(result)
+}
+
+func (s *SQLiteStore) ReadWatchedEpisodes(userID, seriesID bson.ObjectId) (Episodes, error) {
+	result, err := s.queryEpisodes(
+		`SELECT e.id, e.series_id, e.title, e.session, e.episode, e.part, e.absolute, e.aired
+		FROM episodes e
+		JOIN watch_records w ON w.episode_id = e.id
+		WHERE w.user_id = ? AND w.series_id = ?
+		ORDER BY e.rowid`,
+		userID.Hex(),
+		seriesID.Hex(),
+	)
+	if err != nil {
+		return Episodes{}, err
+	}
+
+	sort.Sort(result)
+
+	return result, nil
+}
+
+func (s *SQLiteStore) ReadEpisodeStates(userID bson.ObjectId) ([]EpisodeState, error) {
+	rows, err := s.DB.Query(
+		`SELECT e.id, e.series_id, e.title, e.session, e.episode, e.part, e.absolute, e.aired,
+			COALESCE(w.watched, 0)
+		FROM episodes e
+		LEFT JOIN watch_records w ON w.episode_id = e.id AND w.user_id = ?
+		WHERE e.series_id IN (SELECT series_id FROM user_series WHERE user_id = ?)
+		ORDER BY e.rowid`,
+		userID.Hex(),
+		userID.Hex(),
+	)
+	if err != nil {
+		return []EpisodeState{}, err
+	}
+	defer rows.Close()
+
+	result := []EpisodeState{}
+	for rows.Next() {
+		var id, seriesID string
+		var aired, watched int64
+		state := EpisodeState{}
+		e := &state.Episode
+		err := rows.Scan(&id, &seriesID, &e.Title, &e.Session, &e.Episode, &e.Part, &e.Absolute, &aired, &watched)
+		if err != nil {
+			return []EpisodeState{}, err
+		}
+		e.ID = bson.ObjectIdHex(id)
+		e.SeriesID = bson.ObjectIdHex(seriesID)
+		e.Aired = sqlReadTime(aired)
+		state.Watched = sqlReadTime(watched)
+		result = append(result, state)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return []EpisodeState{}, err
+	}
+
+	return result, nil
+}
+
+func (s *SQLiteStore) NewSession(session aauth.Session) error {
+	_, err := s.DB.Exec(
+		`INSERT INTO sessions (token, user_id, expires) VALUES (?, ?, ?)`,
+		session.Token,
+		session.UserID,
+		session.Expires.UnixNano(),
+	)
+
+	return err
+}
+
+func (s *SQLiteStore) ReadSession(token string) (aauth.Session, error) {
+	var expires int64
+	session := aauth.Session{}
+	row := s.DB.QueryRow(`SELECT token, user_id, expires FROM sessions WHERE token = ?`, token)
+	err := row.Scan(&session.Token, &session.UserID, &expires)
+	if err != nil {
+		return aauth.Session{}, sqlError(err)
+	}
+	session.Expires = time.Unix(0, expires)
+
+	return session, nil
+}
+
+func (s *SQLiteStore) ReadSessionsOfUser(userID string) ([]aauth.Session, error) {
+	rows, err := s.DB.Query(`SELECT token, user_id, expires FROM sessions WHERE user_id = ?`, userID)
+	if err != nil {
+		return []aauth.Session{}, err
+	}
+	defer rows.Close()
+
+	sessions := []aauth.Session{}
+	for rows.Next() {
+		var expires int64
+		session := aauth.Session{}
+		err := rows.Scan(&session.Token, &session.UserID, &expires)
+		if err != nil {
+			return []aauth.Session{}, err
+		}
+		session.Expires = time.Unix(0, expires)
+
+		sessions = append(sessions, session)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return []aauth.Session{}, err
+	}
+
+	return sessions, nil
+}
+
+func (s *SQLiteStore) RemoveSession(token string) error {
+	result, err := s.DB.Exec(`DELETE FROM sessions WHERE token = ?`, token)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(result)
+}
+
+// A zero time is stored as 0, a zero Expires means the token never
+// expires
+func sqlTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+
+	return t.UnixNano()
+}
+
+func sqlReadTime(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, n)
+}
+
+func scanAPIToken(row sqlScanner) (APIToken, error) {
+	var id, userID string
+	var created, expires int64
+	t := APIToken{}
+	err := row.Scan(&id, &userID, &t.Name, &t.Hash, &t.Scope, &created, &expires)
+	if err != nil {
+		return APIToken{}, err
+	}
+	t.ID = bson.ObjectIdHex(id)
+	t.UserID = bson.ObjectIdHex(userID)
+	t.Created = sqlReadTime(created)
+	t.Expires = sqlReadTime(expires)
+
+	return t, nil
+}
+
+func (s *SQLiteStore) NewAPIToken(token APIToken) (bson.ObjectId, error) {
+	id := bson.NewObjectId()
+	_, err := s.DB.Exec(
+		`INSERT INTO api_tokens (`+apiTokenColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		id.Hex(),
+		token.UserID.Hex(),
+		token.Name,
+		token.Hash,
+		token.Scope,
+		sqlTime(token.Created),
+		sqlTime(token.Expires),
+	)
+	if err != nil {
+		return bson.ObjectId(""), err
+	}
+
+	return id, nil
+}
+
+func (s *SQLiteStore) ReadAPIToken(hash string) (APIToken, error) {
+	row := s.DB.QueryRow(`SELECT `+apiTokenColumns+` FROM api_tokens WHERE hash = ?`, hash)
+	token, err := scanAPIToken(row)
+	if err != nil {
+		return APIToken{}, sqlError(err)
+	}
+
+	return token, nil
+}
+
+func (s *SQLiteStore) ReadAPITokensOfUser(userID bson.ObjectId) ([]APIToken, error) {
+	rows, err := s.DB.Query(
+		`SELECT `+apiTokenColumns+` FROM api_tokens WHERE user_id = ? ORDER BY created`,
+		userID.Hex(),
+	)
+	if err != nil {
+		return []APIToken{}, err
+	}
+	defer rows.Close()
+
+	tokens := []APIToken{}
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return []APIToken{}, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return []APIToken{}, err
+	}
+
+	return tokens, nil
+}
+
+func (s *SQLiteStore) RemoveAPIToken(id bson.ObjectId) error {
+	result, err := s.DB.Exec(`DELETE FROM api_tokens WHERE id = ?`, id.Hex())
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(result)
+}
+
+func scanShare(row sqlScanner) (Share, error) {
+	var id, ownerID, userID string
+	var created int64
+	share := Share{}
+	err := row.Scan(&id, &ownerID, &userID, &created)
+	if err != nil {
+		return Share{}, err
+	}
+	share.ID = bson.ObjectIdHex(id)
+	share.OwnerID = bson.ObjectIdHex(ownerID)
+	share.UserID = bson.ObjectIdHex(userID)
+	share.Created = sqlReadTime(created)
+
+	return share, nil
+}
+
+func (s *SQLiteStore) NewShare(share Share) (bson.ObjectId, error) {
+	id := bson.NewObjectId()
+	_, err := s.DB.Exec(
+		`INSERT INTO shares (`+shareColumns+`) VALUES (?, ?, ?, ?)`,
+		id.Hex(),
+		share.OwnerID.Hex(),
+		share.UserID.Hex(),
+		sqlTime(share.Created),
+	)
+	if sqlUniqueError(err) {
+		return bson.ObjectId(""), ShareExistsError
+	}
+
+	if err != nil {
+		return bson.ObjectId(""), err
+	}
+
+	return id, nil
+}
+
+func (s *SQLiteStore) ReadShare(ownerID, userID bson.ObjectId) (Share, error) {
+	row := s.DB.QueryRow(
+		`SELECT `+shareColumns+` FROM shares WHERE owner_id = ? AND user_id = ?`,
+		ownerID.Hex(),
+		userID.Hex(),
+	)
+	share, err := scanShare(row)
+	if err != nil {
+		return Share{}, sqlError(err)
+	}
+
+	return share, nil
+}
+
+func (s *SQLiteStore) readShares(where string, arg interface{}) ([]Share, error) {
+	rows, err := s.DB.Query(
+		`SELECT `+shareColumns+` FROM shares WHERE `+where+` ORDER BY created`,
+		arg,
+	)
+	if err != nil {
+		return []Share{}, err
+	}
+	defer rows.Close()
+
+	shares := []Share{}
+	for rows.Next() {
+		share, err := scanShare(rows)
+		if err != nil {
+			return []Share{}, err
+		}
+		shares = append(shares, share)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return []Share{}, err
+	}
+
+	return shares, nil
+}
+
+func (s *SQLiteStore) ReadSharesOfOwner(ownerID bson.ObjectId) ([]Share, error) {
+	return s.readShares("owner_id = ?", ownerID.Hex())
+}
+
+func (s *SQLiteStore) ReadSharesWithUser(userID bson.ObjectId) ([]Share, error) {
+	return s.readShares("user_id = ?", userID.Hex())
+}
+
+func (s *SQLiteStore) RemoveShare(id bson.ObjectId) error {
+	result, err := s.DB.Exec(`DELETE FROM shares WHERE id = ?`, id.Hex())
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(result)
+}
+
+func (s *SQLiteStore) ReadTOTP(userID bson.ObjectId) (TOTP, error) {
+	var codes string
+	var enabled int
+	var lastFailure int64
+	totp := TOTP{
+		UserID: userID,
+	}
+	err := s.DB.QueryRow(
+		`SELECT secret, enabled, recovery_codes, last_step, failures, last_failure
+		FROM totp WHERE user_id = ?`,
+		userID.Hex(),
+	).Scan(&totp.Secret, &enabled, &codes, &totp.LastStep, &totp.Failures, &lastFailure)
+	if err != nil {
+		return TOTP{}, sqlError(err)
+	}
+	totp.Enabled = enabled == 1
+	totp.LastFailure = sqlReadTime(lastFailure)
+
+	// The hashes are hex strings, a space cannot be part of them
+	totp.RecoveryCodes = []string{}
+	if codes != "" {
+		totp.RecoveryCodes = strings.Split(codes, " ")
+	}
+
+	return totp, nil
+}
+
+func (s *SQLiteStore) SaveTOTP(totp TOTP) error {
+	_, err := s.DB.Exec(
+		`INSERT OR REPLACE INTO totp
+		(user_id, secret, enabled, recovery_codes, last_step, failures, last_failure)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		totp.UserID.Hex(),
+		totp.Secret,
+		sqlBool(totp.Enabled),
+		strings.Join(totp.RecoveryCodes, " "),
+		totp.LastStep,
+		totp.Failures,
+		sqlTime(totp.LastFailure),
+	)
+
+	return err
+}
+
+func (s *SQLiteStore) UseTOTPStep(userID bson.ObjectId, step int64) error {
+	result, err := s.DB.Exec(
+		`UPDATE totp SET last_step = ?, failures = 0 WHERE user_id = ? AND last_step < ?`,
+		step,
+		userID.Hex(),
+		step,
+	)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(result)
+}
+
+// The codes are replaced only if nobody changed them since they were read
+func (s *SQLiteStore) UseRecoveryCode(userID bson.ObjectId, hash string) error {
+	var codes string
+	err := s.DB.QueryRow(`SELECT recovery_codes FROM totp WHERE user_id = ?`, userID.Hex()).Scan(&codes)
+	if err != nil {
+		return sqlError(err)
+	}
+
+	rest := []string{}
+	found := false
+	for _, c := range strings.Split(codes, " ") {
+		if c == hash && !found {
+			found = true
+			continue
+		}
+		if c != "" {
+			rest = append(rest, c)
+		}
+	}
+
+	if !found {
+		return NotFoundError
+	}
+
+	result, err := s.DB.Exec(
+		`UPDATE totp SET recovery_codes = ?, failures = 0 WHERE user_id = ? AND recovery_codes = ?`,
+		strings.Join(rest, " "),
+		userID.Hex(),
+		codes,
+	)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(result)
+}
+
+func (s *SQLiteStore) FailTOTP(userID bson.ObjectId, now time.Time) error {
+	result, err := s.DB.Exec(
+		`UPDATE totp SET failures = failures + 1, last_failure = ? WHERE user_id = ?`,
+		sqlTime(now),
+		userID.Hex(),
+	)
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(result)
+}
+
+func (s *SQLiteStore) RemoveTOTP(userID bson.ObjectId) error {
+	result, err := s.DB.Exec(`DELETE FROM totp WHERE user_id = ?`, userID.Hex())
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(result)
+}
+
+func (s *SQLiteStore) NewJournalEntry(entry JournalEntry) (bson.ObjectId, error) {
+	id := bson.NewObjectId()
+	_, err := s.DB.Exec(
+		`INSERT INTO journal (id, op, user_id, series_id, created) VALUES (?, ?, ?, ?, ?)`,
+		id.Hex(),
+		entry.Op,
+		entry.UserID.Hex(),
+		entry.SeriesID.Hex(),
+		entry.Created.UnixNano(),
+	)
+	if err != nil {
+		return bson.ObjectId(""), err
+	}
+
+	return id, nil
+}
+
+func (s *SQLiteStore) ReadJournal() ([]JournalEntry, error) {
+	rows, err := s.DB.Query(`SELECT id, op, user_id, series_id, created FROM journal ORDER BY created`)
+	if err != nil {
+		return []JournalEntry{}, err
+	}
+	defer rows.Close()
+
+	entries := []JournalEntry{}
+	for rows.Next() {
+		var id, userID, seriesID string
+		var created int64
+		entry := JournalEntry{}
+		err := rows.Scan(&id, &entry.Op, &userID, &seriesID, &created)
+		if err != nil {
+			return []JournalEntry{}, err
+		}
+		entry.ID = bson.ObjectIdHex(id)
+		entry.UserID = bson.ObjectIdHex(userID)
+
+		// Not every op has a series
+		if seriesID != "" {
+			entry.SeriesID = bson.ObjectIdHex(seriesID)
+		}
+		entry.Created = time.Unix(0, created)
+
+		entries = append(entries, entry)
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return []JournalEntry{}, err
+	}
+
+	return entries, nil
+}
+
+func (s *SQLiteStore) RemoveJournalEntry(id bson.ObjectId) error {
+	result, err := s.DB.Exec(`DELETE FROM journal WHERE id = ?`, id.Hex())
+	if err != nil {
+		return err
+	}
+
+	return expectAffected(result)
+}
+
+func (s *SQLiteStore) Close() error {
+	return s.DB.Close()
+}
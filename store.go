@@ -0,0 +1,487 @@
+package sj
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/rrawrriw/angular-sauth-handler"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var (
+	NotFoundError = errors.New("not found")
+)
+
+type (
+	SeriesStore interface {
+		NewSeries(series Series) (bson.ObjectId, error)
+		ReadSeries(id bson.ObjectId) (Series, error)
+		ReadAllSeries(ids []bson.ObjectId) ([]Series, error)
+		UpdateSeries(id bson.ObjectId, change ChangeSeries) error
+		RemoveSeries(id bson.ObjectId) error
+		RemoveSeriesOfUser(userID, seriesID bson.ObjectId) error
+	}
+
+	UserStore interface {
+		NewUser(user User) (bson.ObjectId, error)
+		ReadUser(id bson.ObjectId) (User, error)
+		FindUser(name string) (User, error)
+		// ReadUsers returns all users sorted by name
+		ReadUsers() ([]User, error)
+		ReadSeriesOfUser(id bson.ObjectId) ([]Series, error)
+		UpdateUser(id bson.ObjectId, change ChangeUser) error
+		RemoveUser(id bson.ObjectId) error
+	}
+
+	EpisodeStore interface {
+		NewEpisode(episode Episode) (bson.ObjectId, error)
+		NewEpisodeBatch(episodes []Episode) ([]bson.ObjectId, error)
+		ReadEpisode(id bson.ObjectId) (Episode, error)
+		ReadEpisodes(seriesID bson.ObjectId) ([]Episode, error)
+		WatchEpisode(userID, id bson.ObjectId) error
+		UnwatchEpisode(userID, id bson.ObjectId) error
+		ReadWatchedEpisodes(userID, seriesID bson.ObjectId) (Episodes, error)
+		// ReadEpisodeStates returns the episodes of every series of the
+		// user with his watch times in a single query
+		ReadEpisodeStates(userID bson.ObjectId) ([]EpisodeState, error)
+	}
+
+	SessionStore interface {
+		NewSession(session aauth.Session) error
+		ReadSession(token string) (aauth.Session, error)
+		ReadSessionsOfUser(userID string) ([]aauth.Session, error)
+		RemoveSession(token string) error
+	}
+
+	APITokenStore interface {
+		NewAPIToken(token APIToken) (bson.ObjectId, error)
+		ReadAPIToken(hash string) (APIToken, error)
+		ReadAPITokensOfUser(userID bson.ObjectId) ([]APIToken, error)
+		RemoveAPIToken(id bson.ObjectId) error
+	}
+
+	ShareStore interface {
+		NewShare(share Share) (bson.ObjectId, error)
+		// ReadShare returns the share of the owner with the user
+		ReadShare(ownerID, userID bson.ObjectId) (Share, error)
+		ReadSharesOfOwner(ownerID bson.ObjectId) ([]Share, error)
+		ReadSharesWithUser(userID bson.ObjectId) ([]Share, error)
+		RemoveShare(id bson.ObjectId) error
+	}
+
+	TOTPStore interface {
+		ReadTOTP(userID bson.ObjectId) (TOTP, error)
+		// SaveTOTP creates or replaces the TOTP of the user
+		SaveTOTP(totp TOTP) error
+		RemoveTOTP(userID bson.ObjectId) error
+		// UseTOTPStep saves the step of a valid code and resets the
+		// failures, NotFoundError if the LastStep is not before the step.
+		UseTOTPStep(userID bson.ObjectId, step int64) error
+		// UseRecoveryCode removes the hash of a recovery code and resets
+		// the failures, NotFoundError if the hash is already removed.
+		UseRecoveryCode(userID bson.ObjectId, hash string) error
+		// FailTOTP counts a wrong code
+		FailTOTP(userID bson.ObjectId, now time.Time) error
+	}
+
+	JournalStore interface {
+		NewJournalEntry(entry JournalEntry) (bson.ObjectId, error)
+		ReadJournal() ([]JournalEntry, error)
+		RemoveJournalEntry(id bson.ObjectId) error
+	}
+
+	// Store is everything the handlers need to persist data,
+	// independent of the database behind it.
+	Store interface {
+		SeriesStore
+		UserStore
+		EpisodeStore
+		SessionStore
+		APITokenStore
+		TOTPStore
+		ShareStore
+		JournalStore
+		Close() error
+	}
+
+	// MgoStore implements Store with the functions from db-ctrl.go.
+	// Every operation works on its own copy of the mgo session.
+	MgoStore struct {
+		Session *mgo.Session
+		DBName  string
+		mutex   *sync.Mutex
+	}
+)
+
+func NewMgoStore(session *mgo.Session, dbName string) MgoStore {
+	return MgoStore{
+		Session: session,
+		DBName:  dbName,
+		mutex:   &sync.Mutex{},
+	}
+}
+
+func (s MgoStore) DB() *mgo.Database {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	sCopy := s.Session.Copy()
+
+	return sCopy.DB(s.DBName)
+}
+
+func (s MgoStore) Close() error {
+	s.Session.Close()
+	return nil
+}
+
+func mgoError(err error) error {
+	if err == mgo.ErrNotFound {
+		return NotFoundError
+	}
+
+	return err
+}
+
+// Users.Name has a unique index, a duplicate key is a taken name
+func mgoUserError(err error) error {
+	if mgo.IsDup(err) {
+		return UserExistsError
+	}
+
+	return mgoError(err)
+}
+
+func (s MgoStore) NewSeries(series Series) (bson.ObjectId, error) {
+	db := s.DB()
+	defer db.Session.Close()
+
+	id, err := NewSeries(db, series)
+	return id, mgoError(err)
+}
+
+func (s MgoStore) ReadSeries(id bson.ObjectId) (Series, error) {
+	db := s.DB()
+	defer db.Session.Close()
+
+	series, err := ReadSeries(db, id)
+	return series, mgoError(err)
+}
+
+func (s MgoStore) ReadAllSeries(ids []bson.ObjectId) ([]Series, error) {
+	db := s.DB()
+	defer db.Session.Close()
+
+	sList, err := ReadAllSeries(db, ids)
+	return sList, mgoError(err)
+}
+
+func (s MgoStore) UpdateSeries(id bson.ObjectId, change ChangeSeries) error {
+	db := s.DB()
+	defer db.Session.Close()
+
+	return mgoError(UpdateSeries(db, id, change))
+}
+
+func (s MgoStore) RemoveSeries(id bson.ObjectId) error {
+	db := s.DB()
+	defer db.Session.Close()
+
+	return mgoError(RemoveSeries(db, id))
+}
+
+func (s MgoStore) RemoveSeriesOfUser(userID, seriesID bson.ObjectId) error {
+	db := s.DB()
+	defer db.Session.Close()
+
+	return mgoError(RemoveSeriesOfUser(db, userID, seriesID))
+}
+
+func (s MgoStore) NewUser(user User) (bson.ObjectId, error) {
+	db := s.DB()
+	defer db.Session.Close()
+
+	id, err := NewUser(db, user)
+	return id, mgoUserError(err)
+}
+
+func (s MgoStore) ReadUser(id bson.ObjectId) (User, error) {
+	db := s.DB()
+	defer db.Session.Close()
+
+	user, err := ReadUser(db, id)
+	return user, mgoError(err)
+}
+
+func (s MgoStore) ReadUsers() ([]User, error) {
+	db := s.DB()
+	defer db.Session.Close()
+
+	users, err := ReadUsers(db)
+	return users, mgoError(err)
+}
+
+func (s MgoStore) FindUser(name string) (User, error) {
+	db := s.DB()
+	defer db.Session.Close()
+
+	user, err := FindUser(db, name)
+	return user, mgoError(err)
+}
+
+func (s MgoStore) ReadSeriesOfUser(id bson.ObjectId) ([]Series, error) {
+	db := s.DB()
+	defer db.Session.Close()
+
+	sList, err := ReadSeriesOfUser(db, id)
+	return sList, mgoError(err)
+}
+
+func (s MgoStore) UpdateUser(id bson.ObjectId, change ChangeUser) error {
+	db := s.DB()
+	defer db.Session.Close()
+
+	return mgoUserError(UpdateUser(db, id, change))
+}
+
+func (s MgoStore) RemoveUser(id bson.ObjectId) error {
+	db := s.DB()
+	defer db.Session.Close()
+
+	return mgoError(RemoveUser(db, id))
+}
+
+func (s MgoStore) NewEpisode(episode Episode) (bson.ObjectId, error) {
+	db := s.DB()
+	defer db.Session.Close()
+
+	id, err := NewEpisode(db, episode)
+	return id, mgoError(err)
+}
+
+func (s MgoStore) NewEpisodeBatch(episodes []Episode) ([]bson.ObjectId, error) {
+	db := s.DB()
+	defer db.Session.Close()
+
+	ids, err := NewEpisodeBatch(db, episodes)
+	return ids, mgoError(err)
+}
+
+func (s MgoStore) ReadEpisode(id bson.ObjectId) (Episode, error) {
+	db := s.DB()
+	defer db.Session.Close()
+
+	episode, err := ReadEpisode(db, id)
+	return episode, mgoError(err)
+}
+
+func (s MgoStore) ReadEpisodes(seriesID bson.ObjectId) ([]Episode, error) {
+	db := s.DB()
+	defer db.Session.Close()
+
+	episodes, err := ReadEpisodes(db, seriesID)
+	return episodes, mgoError(err)
+}
+
+func (s MgoStore) WatchEpisode(userID, id bson.ObjectId) error {
+	db := s.DB()
+	defer db.Session.Close()
+
+	return mgoError(WatchEpisode(db, userID, id))
+}
+
+func (s MgoStore) UnwatchEpisode(userID, id bson.ObjectId) error {
+	db := s.DB()
+	defer db.Session.Close()
+
+	return mgoError(UnwatchEpisode(db, userID, id))
+}
+
+func (s MgoStore) ReadWatchedEpisodes(userID, seriesID bson.ObjectId) (Episodes, error) {
+	db := s.DB()
+	defer db.Session.Close()
+
+	episodes, err := ReadWatchedEpisodes(db, userID, seriesID)
+	return episodes, mgoError(err)
+}
+
+func (s MgoStore) ReadEpisodeStates(userID bson.ObjectId) ([]EpisodeState, error) {
+	db := s.DB()
+	defer db.Session.Close()
+
+	states, err := ReadEpisodeStates(db, userID)
+	return states, mgoError(err)
+}
+
+func (s MgoStore) NewSession(session aauth.Session) error {
+	db := s.DB()
+	defer db.Session.Close()
+
+	return mgoError(NewSession(db, session))
+}
+
+func (s MgoStore) ReadSession(token string) (aauth.Session, error) {
+	db := s.DB()
+	defer db.Session.Close()
+
+	session, err := ReadSession(db, token)
+	return session, mgoError(err)
+}
+
+func (s MgoStore) ReadSessionsOfUser(userID string) ([]aauth.Session, error) {
+	db := s.DB()
+	defer db.Session.Close()
+
+	sessions, err := ReadSessionsOfUser(db, userID)
+	return sessions, mgoError(err)
+}
+
+func (s MgoStore) RemoveSession(token string) error {
+	db := s.DB()
+	defer db.Session.Close()
+
+	return mgoError(RemoveSession(db, token))
+}
+
+func (s MgoStore) NewAPIToken(token APIToken) (bson.ObjectId, error) {
+	db := s.DB()
+	defer db.Session.Close()
+
+	id, err := NewAPIToken(db, token)
+	return id, mgoError(err)
+}
+
+func (s MgoStore) ReadAPIToken(hash string) (APIToken, error) {
+	db := s.DB()
+	defer db.Session.Close()
+
+	token, err := ReadAPIToken(db, hash)
+	return token, mgoError(err)
+}
+
+func (s MgoStore) ReadAPITokensOfUser(userID bson.ObjectId) ([]APIToken, error) {
+	db := s.DB()
+	defer db.Session.Close()
+
+	tokens, err := ReadAPITokensOfUser(db, userID)
+	return tokens, mgoError(err)
+}
+
+func (s MgoStore) RemoveAPIToken(id bson.ObjectId) error {
+	db := s.DB()
+	defer db.Session.Close()
+
+	return mgoError(RemoveAPIToken(db, id))
+}
+
+func (s MgoStore) NewShare(share Share) (bson.ObjectId, error) {
+	db := s.DB()
+	defer db.Session.Close()
+
+	id, err := NewShare(db, share)
+	if mgo.IsDup(err) {
+		return bson.ObjectId(""), ShareExistsError
+	}
+
+	return id, mgoError(err)
+}
+
+func (s MgoStore) ReadShare(ownerID, userID bson.ObjectId) (Share, error) {
+	db := s.DB()
+	defer db.Session.Close()
+
+	share, err := ReadShare(db, ownerID, userID)
+	return share, mgoError(err)
+}
+
+func (s MgoStore) ReadSharesOfOwner(ownerID bson.ObjectId) ([]Share, error) {
+	db := s.DB()
+	defer db.Session.Close()
+
+	shares, err := ReadShares(db, bson.M{"OwnerID": ownerID})
+	return shares, mgoError(err)
+}
+
+func (s MgoStore) ReadSharesWithUser(userID bson.ObjectId) ([]Share, error) {
+	db := s.DB()
+	defer db.Session.Close()
+
+	shares, err := ReadShares(db, bson.M{"UserID": userID})
+	return shares, mgoError(err)
+}
+
+func (s MgoStore) RemoveShare(id bson.ObjectId) error {
+	db := s.DB()
+	defer db.Session.Close()
+
+	return mgoError(RemoveShare(db, id))
+}
+
+func (s MgoStore) ReadTOTP(userID bson.ObjectId) (TOTP, error) {
+	db := s.DB()
+	defer db.Session.Close()
+
+	totp, err := ReadTOTP(db, userID)
+	return totp, mgoError(err)
+}
+
+func (s MgoStore) SaveTOTP(totp TOTP) error {
+	db := s.DB()
+	defer db.Session.Close()
+
+	return mgoError(SaveTOTP(db, totp))
+}
+
+func (s MgoStore) RemoveTOTP(userID bson.ObjectId) error {
+	db := s.DB()
+	defer db.Session.Close()
+
+	return mgoError(RemoveTOTP(db, userID))
+}
+
+func (s MgoStore) UseTOTPStep(userID bson.ObjectId, step int64) error {
+	db := s.DB()
+	defer db.Session.Close()
+
+	return mgoError(UseTOTPStep(db, userID, step))
+}
+
+func (s MgoStore) UseRecoveryCode(userID bson.ObjectId, hash string) error {
+	db := s.DB()
+	defer db.Session.Close()
+
+	return mgoError(UseRecoveryCode(db, userID, hash))
+}
+
+func (s MgoStore) FailTOTP(userID bson.ObjectId, now time.Time) error {
+	db := s.DB()
+	defer db.Session.Close()
+
+	return mgoError(FailTOTP(db, userID, now))
+}
+
+func (s MgoStore) NewJournalEntry(entry JournalEntry) (bson.ObjectId, error) {
+	db := s.DB()
+	defer db.Session.Close()
+
+	id, err := NewJournalEntry(db, entry)
+	return id, mgoError(err)
+}
+
+func (s MgoStore) ReadJournal() ([]JournalEntry, error) {
+	db := s.DB()
+	defer db.Session.Close()
+
+	entries, err := ReadJournal(db)
+	return entries, mgoError(err)
+}
+
+func (s MgoStore) RemoveJournalEntry(id bson.ObjectId) error {
+	db := s.DB()
+	defer db.Session.Close()
+
+	return mgoError(RemoveJournalEntry(db, id))
+}
@@ -0,0 +1,320 @@
+package sj
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rrawrriw/angular-sauth-handler"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// ReadScope tokens may only send GET and HEAD requests
+	ReadScope      = "read"
+	ReadWriteScope = "read-write"
+
+	APITokenKey    = "APIToken"
+	APITokenPrefix = "sj_"
+)
+
+type (
+	// APIToken is a personal access token for scripts. Only the SHA-256
+	// hash of the token is stored, the token itself is shown once.
+	APIToken struct {
+		ID      bson.ObjectId `bson:"_id,omitempty"`
+		UserID  bson.ObjectId `bson:"UserID"`
+		Name    string        `bson:"Name"`
+		Hash    string        `bson:"Hash"`
+		Scope   string        `bson:"Scope"`
+		Created time.Time     `bson:"Created"`
+		// Zero means the token never expires
+		Expires time.Time `bson:"Expires"`
+	}
+
+	APITokenData struct {
+		ID      string
+		Name    string
+		Scope   string
+		Created time.Time
+		Expires time.Time
+	}
+
+	NewAPITokenData struct {
+		APITokenData
+		Token string
+	}
+
+	NewAPITokenRequest struct {
+		Name    string
+		Scope   string
+		Expires time.Duration
+	}
+
+	NewAPITokenBody struct {
+		Name  *string
+		Scope *string
+		// Optional, a duration like "720h"
+		Expires *string
+	}
+)
+
+// The tokens are long random strings, a fast hash is enough to keep them
+// unusable when the database leaks.
+func HashAPIToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+func NewAPITokenString() (string, error) {
+	t, err := NewSessionToken()
+	if err != nil {
+		return "", err
+	}
+
+	return APITokenPrefix + t, nil
+}
+
+func ValidScope(scope string) bool {
+	return scope == ReadScope || scope == ReadWriteScope
+}
+
+func (t APIToken) Expired(now time.Time) bool {
+	return !t.Expires.IsZero() && t.Expires.Before(now)
+}
+
+// Allows reports if the scope of the token permits the request method
+func (t APIToken) Allows(method string) bool {
+	switch t.Scope {
+	case ReadWriteScope:
+		return true
+	case ReadScope:
+		return method == "GET" || method == "HEAD"
+	}
+
+	return false
+}
+
+func (t APIToken) Data() APITokenData {
+	return APITokenData{
+		ID:      t.ID.Hex(),
+		Name:    t.Name,
+		Scope:   t.Scope,
+		Created: t.Created,
+		Expires: t.Expires,
+	}
+}
+
+func ReadBearerToken(r *http.Request) (string, bool) {
+	h := r.Header.Get("Authorization")
+	if !strings.HasPrefix(h, "Bearer ") {
+		return "", false
+	}
+
+	token := strings.TrimSpace(strings.TrimPrefix(h, "Bearer "))
+	if token == "" {
+		return "", false
+	}
+
+	return token, true
+}
+
+// BearerAuth accepts personal API tokens from the Authorization header,
+// requests without one are handed to SessionAuth. A valid token sets a
+// session for its user, so the handlers work like with SessionAuth.
+func BearerAuth(app AppContext) gin.HandlerFunc {
+	sessionAuth := SessionAuth(app)
+
+	return func(c *gin.Context) {
+		if c.Request.Header.Get("Authorization") == "" {
+			sessionAuth(c)
+			return
+		}
+
+		token, ok := ReadBearerToken(c.Request)
+		if !ok {
+			AbortWithFail(c, NewUnauthorizedError("Wrong API token"))
+			return
+		}
+
+		t, err := app.Store().ReadAPIToken(HashAPIToken(token))
+		if err != nil {
+			AbortWithFail(c, NewUnauthorizedError("Wrong API token"))
+			return
+		}
+
+		if t.Expired(app.Now()) {
+			AbortWithFail(c, NewUnauthorizedError("Wrong API token"))
+			return
+		}
+
+		if !t.Allows(c.Request.Method) {
+			m := fmt.Sprintf("Token scope does not allow %v", c.Request.Method)
+			AbortWithFail(c, NewForbiddenError(m))
+			return
+		}
+
+		user, err := app.Store().ReadUser(t.UserID)
+		if err != nil || user.Disabled {
+			AbortWithFail(c, NewUnauthorizedError("Wrong API token"))
+			return
+		}
+
+		session := aauth.Session{
+			UserID:  t.UserID.Hex(),
+			Expires: t.Expires,
+		}
+		c.Set(SessionKey, session)
+		c.Set(APITokenKey, t)
+		c.Next()
+	}
+}
+
+func ParseNewAPITokenRequest(r *http.Request) (NewAPITokenRequest, error) {
+	body, err := DecodeRequest[NewAPITokenBody](r)
+	if err != nil {
+		return NewAPITokenRequest{}, err
+	}
+
+	v := &Validator{}
+	name := v.RequiredString("Name", body.Name)
+	scope := v.RequiredString("Scope", body.Scope)
+	if scope != "" && !ValidScope(scope) {
+		msg := fmt.Sprintf("Wrong scope %v", scope)
+		v.Add("Scope", WrongFieldCode, msg)
+	}
+
+	// Without Expires the token does not expire
+	var expires time.Duration
+	if body.Expires != nil && *body.Expires != "" {
+		expires, err = time.ParseDuration(*body.Expires)
+		if err != nil || expires <= 0 {
+			v.Wrong("Expires")
+		}
+	}
+
+	err = v.Err()
+	if err != nil {
+		return NewAPITokenRequest{}, err
+	}
+
+	tokenReq := NewAPITokenRequest{
+		Name:    name,
+		Scope:   scope,
+		Expires: expires,
+	}
+
+	return tokenReq, nil
+}
+
+func NewAPITokenHandler(c *gin.Context, app AppContext) error {
+	req, err := ParseNewAPITokenRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	store := app.Store()
+	user, err := ReadSessionUser(c, store)
+	if err != nil {
+		return err
+	}
+
+	token, err := NewAPITokenString()
+	if err != nil {
+		return err
+	}
+
+	now := app.Now()
+	t := APIToken{
+		UserID:  user.Id,
+		Name:    req.Name,
+		Hash:    HashAPIToken(token),
+		Scope:   req.Scope,
+		Created: now,
+	}
+
+	if req.Expires > 0 {
+		t.Expires = now.Add(req.Expires)
+	}
+
+	id, err := store.NewAPIToken(t)
+	if err != nil {
+		return err
+	}
+	t.ID = id
+
+	data := NewAPITokenData{
+		APITokenData: t.Data(),
+		Token:        token,
+	}
+	c.JSON(http.StatusOK, NewSuccessResponse(data))
+
+	return nil
+}
+
+func ReadAPITokensHandler(c *gin.Context, app AppContext) error {
+	store := app.Store()
+	user, err := ReadSessionUser(c, store)
+	if err != nil {
+		return err
+	}
+
+	tokens, err := store.ReadAPITokensOfUser(user.Id)
+	if err != nil {
+		return err
+	}
+
+	data := []APITokenData{}
+	for _, t := range tokens {
+		data = append(data, t.Data())
+	}
+	c.JSON(http.StatusOK, NewSuccessResponse(data))
+
+	return nil
+}
+
+func RemoveAPITokenHandler(c *gin.Context, app AppContext) error {
+	id, err := ParseIDParam(c, "id")
+	if err != nil {
+		return err
+	}
+
+	store := app.Store()
+	user, err := ReadSessionUser(c, store)
+	if err != nil {
+		return err
+	}
+
+	tokens, err := store.ReadAPITokensOfUser(user.Id)
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, t := range tokens {
+		if t.ID == id {
+			found = true
+		}
+	}
+
+	if !found {
+		m := fmt.Sprintf("Cannot find %v", id.Hex())
+		return NewNotFoundError(m)
+	}
+
+	err = store.RemoveAPIToken(id)
+	if err != nil {
+		return err
+	}
+
+	data := IDData{
+		ID: id.Hex(),
+	}
+	c.JSON(http.StatusOK, NewSuccessResponse(data))
+
+	return nil
+}
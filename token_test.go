@@ -0,0 +1,159 @@
+package sj
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+const TestSeriesBody = `
+{
+	"Data": {
+		"Title": "Elementary",
+		"Image": [],
+		"Desc": [],
+		"Episodes": [],
+		"Portal": []
+	}
+}`
+
+func NewTestAPIToken(t *testing.T, env *TestEnv, session, scope string) NewAPITokenData {
+	req := env.Request(`
+	{
+		"Data": {
+			"Name": "backup script",
+			"Scope": "` + scope + `"
+		}
+	}`)
+
+	resp := req.SendWithToken("POST", "/tokens", session)
+
+	result := struct {
+		Status string
+		Data   NewAPITokenData
+	}{}
+	err := json.Unmarshal(resp.Body.Bytes(), &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Status != "success" || result.Data.Token == "" {
+		t.Fatal("Expect a token was", resp.Body)
+	}
+
+	return result.Data
+}
+
+func Test_BearerAuth_OK(t *testing.T) {
+	env := NewTestEnv(t)
+	store := env.Store
+	defer env.Close()
+
+	user, session, _ := NewTestDBEnv(t, store)
+	token := NewTestAPIToken(t, env, session.Token, ReadWriteScope)
+
+	// Only the hash is stored
+	_, err := store.ReadAPIToken(token.Token)
+	if err != NotFoundError {
+		t.Fatal("Expect", NotFoundError, "was", err)
+	}
+
+	req := env.Request("")
+	resp := req.SendWithBearer("GET", "/users/"+user.Id.Hex()+"/series", token.Token)
+	if resp.Code != http.StatusOK {
+		t.Fatal("Expect", http.StatusOK, "was", resp.Code, resp.Body)
+	}
+
+	req = env.Request(TestSeriesBody)
+	resp = req.SendWithBearer("POST", "/series", token.Token)
+	if resp.Code != http.StatusOK {
+		t.Fatal("Expect", http.StatusOK, "was", resp.Code, resp.Body)
+	}
+
+	req = env.Request("")
+	resp = req.SendWithBearer("GET", "/users/"+user.Id.Hex()+"/series", "sj_wrong")
+	if resp.Code != http.StatusUnauthorized {
+		t.Fatal("Expect", http.StatusUnauthorized, "was", resp.Code)
+	}
+}
+
+func Test_BearerAuth_FailReadScope(t *testing.T) {
+	env := NewTestEnv(t)
+	store := env.Store
+	defer env.Close()
+
+	user, session, _ := NewTestDBEnv(t, store)
+	token := NewTestAPIToken(t, env, session.Token, ReadScope)
+
+	req := env.Request("")
+	resp := req.SendWithBearer("GET", "/users/"+user.Id.Hex()+"/series", token.Token)
+	if resp.Code != http.StatusOK {
+		t.Fatal("Expect", http.StatusOK, "was", resp.Code, resp.Body)
+	}
+
+	req = env.Request(TestSeriesBody)
+	resp = req.SendWithBearer("POST", "/series", token.Token)
+	if resp.Code != http.StatusForbidden {
+		t.Fatal("Expect", http.StatusForbidden, "was", resp.Code)
+	}
+}
+
+func Test_BearerAuth_FailRevokedToken(t *testing.T) {
+	env := NewTestEnv(t)
+	store := env.Store
+	defer env.Close()
+
+	user, session, _ := NewTestDBEnv(t, store)
+	token := NewTestAPIToken(t, env, session.Token, ReadScope)
+
+	req := env.Request("")
+	resp := req.SendWithToken("DELETE", "/tokens/"+token.ID, session.Token)
+	if resp.Code != http.StatusOK {
+		t.Fatal("Expect", http.StatusOK, "was", resp.Code, resp.Body)
+	}
+
+	req = env.Request("")
+	resp = req.SendWithBearer("GET", "/users/"+user.Id.Hex()+"/series", token.Token)
+	if resp.Code != http.StatusUnauthorized {
+		t.Fatal("Expect", http.StatusUnauthorized, "was", resp.Code)
+	}
+}
+
+func Test_ParseNewAPITokenRequest_FailMissingFields(t *testing.T) {
+	_, err := ParseNewAPITokenRequest(NewTestRequest(`{"Data": {}}`, ""))
+
+	expect := []FieldError{
+		{Field: "Name", Code: MissingFieldCode},
+		{Field: "Scope", Code: MissingFieldCode},
+	}
+	if !EqualFieldErrors(err, expect) {
+		t.Fatal("Expect", expect, "was", err)
+	}
+
+	body := `{"Data": {"Name": "", "Scope": "admin", "Expires": "soon"}}`
+	_, err = ParseNewAPITokenRequest(NewTestRequest(body, ""))
+
+	expect = []FieldError{
+		{Field: "Name", Code: MissingFieldCode},
+		{Field: "Scope", Code: WrongFieldCode},
+		{Field: "Expires", Code: WrongFieldCode},
+	}
+	if !EqualFieldErrors(err, expect) {
+		t.Fatal("Expect", expect, "was", err)
+	}
+}
+
+func Test_APIToken_Expired(t *testing.T) {
+	now := time.Now()
+
+	token := APIToken{}
+	if token.Expired(now) {
+		t.Fatal("Expect a token without Expires to be valid")
+	}
+
+	token.Expires = now.Add(-time.Minute)
+	if !token.Expired(now) {
+		t.Fatal("Expect an expired token")
+	}
+}
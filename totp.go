@@ -0,0 +1,407 @@
+package sj
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// RFC 6238 with the defaults every authenticator app understands
+const (
+	TOTPIssuer    = "sj"
+	TOTPDigits    = 6
+	TOTPPeriod    = 30
+	TOTPSkew      = 1
+	RecoveryCodes = 10
+
+	// Wrong codes in a row lock the second factor for TOTPLockout, after
+	// it every wrong code locks it again until a valid code
+	TOTPMaxFailures = 5
+	TOTPLockout     = 15 * time.Minute
+)
+
+var (
+	TOTPRequiredError = NewAPIError(http.StatusUnauthorized, "totp_required", "Two-factor code is missing")
+	TOTPCodeError     = NewAPIError(http.StatusUnauthorized, "wrong_totp", "Wrong two-factor code")
+	TOTPEnabledError  = NewConflictError("totp_enabled", "Two-factor authentication is enabled")
+	TOTPMissingError  = NewNotFoundError("Two-factor authentication is not set up")
+	TOTPLockedError   = NewAPIError(http.StatusTooManyRequests, "totp_locked", "Too many wrong two-factor codes, try again later")
+
+	totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+)
+
+type (
+	// TOTP is the second factor of a user. It is saved with Enabled false
+	// when the enrollment starts and enabled after the first valid code.
+	// Only SHA-256 hashes of the recovery codes are stored.
+	TOTP struct {
+		UserID        bson.ObjectId `bson:"_id"`
+		Secret        string        `bson:"Secret"`
+		Enabled       bool          `bson:"Enabled"`
+		RecoveryCodes []string      `bson:"RecoveryCodes"`
+		// A code is accepted once, later codes need a later time step
+		LastStep int64 `bson:"LastStep"`
+		// Wrong codes since the last valid one, see Locked
+		Failures    int       `bson:"Failures"`
+		LastFailure time.Time `bson:"LastFailure"`
+	}
+
+	TOTPEnrollData struct {
+		Secret string
+		URI    string
+	}
+
+	RecoveryCodesData struct {
+		RecoveryCodes []string
+	}
+
+	CodeBody struct {
+		Code string
+	}
+
+	PasswordBody struct {
+		Password *string
+	}
+)
+
+func NewTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return totpEncoding.EncodeToString(b), nil
+}
+
+func TOTPStep(t time.Time) int64 {
+	return t.Unix() / TOTPPeriod
+}
+
+// TOTPCode calculates the code of the time step, see RFC 4226 5.3
+func TOTPCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(step))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	bin := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < TOTPDigits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", TOTPDigits, bin%mod), nil
+}
+
+// URI is the otpauth:// URI which authenticator apps read from a QR code
+func (t TOTP) URI(name string) string {
+	label := url.PathEscape(TOTPIssuer + ":" + name)
+
+	v := url.Values{}
+	v.Set("secret", t.Secret)
+	v.Set("issuer", TOTPIssuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprintf("%v", TOTPDigits))
+	v.Set("period", fmt.Sprintf("%v", TOTPPeriod))
+
+	return "otpauth://totp/" + label + "?" + v.Encode()
+}
+
+// Verify checks the code against the time steps around now and returns
+// the step of a valid code, Store.UseTOTPStep has to accept it.
+func (t TOTP) Verify(code string, now time.Time) (int64, bool) {
+	step := TOTPStep(now)
+	for s := step - TOTPSkew; s <= step+TOTPSkew; s++ {
+		if s <= t.LastStep {
+			continue
+		}
+
+		expect, err := TOTPCode(t.Secret, s)
+		if err != nil {
+			return 0, false
+		}
+
+		if subtle.ConstantTimeCompare([]byte(expect), []byte(code)) == 1 {
+			return s, true
+		}
+	}
+
+	return 0, false
+}
+
+// RecoveryCodeHash returns the hash of a matching recovery code, every code
+// works once because Store.UseRecoveryCode removes it.
+func (t TOTP) RecoveryCodeHash(code string) (string, bool) {
+	hash := HashAPIToken(NormalizeRecoveryCode(code))
+	for _, c := range t.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(c), []byte(hash)) == 1 {
+			return hash, true
+		}
+	}
+
+	return "", false
+}
+
+func (t TOTP) Locked(now time.Time) bool {
+	return t.Failures >= TOTPMaxFailures && now.Before(t.LastFailure.Add(TOTPLockout))
+}
+
+// useCode accepts a TOTP or, if recovery is true, a recovery code. A code
+// which another request used first and a wrong code count as failures.
+func useCode(store Store, totp TOTP, code string, now time.Time, recovery bool) error {
+	if totp.Locked(now) {
+		return TOTPLockedError
+	}
+
+	err := NotFoundError
+	if step, ok := totp.Verify(code, now); ok {
+		err = store.UseTOTPStep(totp.UserID, step)
+	} else if hash, ok := totp.RecoveryCodeHash(code); ok && recovery {
+		err = store.UseRecoveryCode(totp.UserID, hash)
+	}
+
+	if err != NotFoundError {
+		return err
+	}
+
+	err = store.FailTOTP(totp.UserID, now)
+	if err != nil {
+		return err
+	}
+
+	return TOTPCodeError
+}
+
+// Recovery codes are typed by hand, case and dashes do not matter
+func NormalizeRecoveryCode(code string) string {
+	code = strings.Replace(code, "-", "", -1)
+	code = strings.Replace(code, " ", "", -1)
+
+	return strings.ToUpper(code)
+}
+
+// NewRecoveryCodes returns the codes for the user and their hashes
+func NewRecoveryCodes(n int) ([]string, []string, error) {
+	codes := []string{}
+	hashes := []string{}
+	for i := 0; i < n; i++ {
+		b := make([]byte, 5)
+		_, err := rand.Read(b)
+		if err != nil {
+			return []string{}, []string{}, err
+		}
+
+		c := totpEncoding.EncodeToString(b)
+		codes = append(codes, c[:4]+"-"+c[4:])
+		hashes = append(hashes, HashAPIToken(c))
+	}
+
+	return codes, hashes, nil
+}
+
+// CheckSecondFactor is part of the login, users without an enabled TOTP
+// pass. The code may be a TOTP code or a recovery code.
+func CheckSecondFactor(store Store, userID bson.ObjectId, code string, now time.Time) error {
+	totp, err := store.ReadTOTP(userID)
+	if err == NotFoundError {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !totp.Enabled {
+		return nil
+	}
+
+	if code == "" {
+		return TOTPRequiredError
+	}
+
+	return useCode(store, totp, code, now, true)
+}
+
+func ParseCodeRequest(r *http.Request) (string, error) {
+	body, err := DecodeRequest[CodeBody](r)
+	if err != nil {
+		return "", err
+	}
+
+	v := &Validator{}
+	v.Required("Code", body.Code)
+
+	return body.Code, v.Err()
+}
+
+func ParsePasswordRequest(r *http.Request) (string, error) {
+	body, err := DecodeRequest[PasswordBody](r)
+	if err != nil {
+		return "", err
+	}
+
+	v := &Validator{}
+	pass := v.RequiredString("Password", body.Password)
+
+	return pass, v.Err()
+}
+
+// Starts the enrollment with a new secret, an unconfirmed secret is
+// replaced.
+func EnrollTOTPHandler(c *gin.Context, app AppContext) error {
+	store := app.Store()
+	user, err := ReadSessionUser(c, store)
+	if err != nil {
+		return err
+	}
+
+	totp, err := store.ReadTOTP(user.Id)
+	if err != nil && err != NotFoundError {
+		return err
+	}
+
+	if err == nil && totp.Enabled {
+		return TOTPEnabledError
+	}
+
+	secret, err := NewTOTPSecret()
+	if err != nil {
+		return err
+	}
+
+	totp = TOTP{
+		UserID:        user.Id,
+		Secret:        secret,
+		RecoveryCodes: []string{},
+	}
+	err = store.SaveTOTP(totp)
+	if err != nil {
+		return err
+	}
+
+	data := TOTPEnrollData{
+		Secret: totp.Secret,
+		URI:    totp.URI(user.Name),
+	}
+	c.JSON(http.StatusOK, NewSuccessResponse(data))
+
+	return nil
+}
+
+// Enables the TOTP with the first valid code and returns the recovery
+// codes, they are shown only once.
+func ConfirmTOTPHandler(c *gin.Context, app AppContext) error {
+	code, err := ParseCodeRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	store := app.Store()
+	user, err := ReadSessionUser(c, store)
+	if err != nil {
+		return err
+	}
+
+	totp, err := store.ReadTOTP(user.Id)
+	if err == NotFoundError {
+		return TOTPMissingError
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if totp.Enabled {
+		return TOTPEnabledError
+	}
+
+	err = useCode(store, totp, code, app.Now(), false)
+	if err != nil {
+		return err
+	}
+
+	codes, hashes, err := NewRecoveryCodes(RecoveryCodes)
+	if err != nil {
+		return err
+	}
+
+	// Keeps the step of the code and the reset failures
+	totp, err = store.ReadTOTP(user.Id)
+	if err != nil {
+		return err
+	}
+
+	totp.Enabled = true
+	totp.RecoveryCodes = hashes
+	err = store.SaveTOTP(totp)
+	if err != nil {
+		return err
+	}
+
+	data := RecoveryCodesData{
+		RecoveryCodes: codes,
+	}
+	c.JSON(http.StatusOK, NewSuccessResponse(data))
+
+	return nil
+}
+
+// Removes the TOTP of the session user, the password is required again
+func DisableTOTPHandler(c *gin.Context, app AppContext) error {
+	pass, err := ParsePasswordRequest(c.Request)
+	if err != nil {
+		return err
+	}
+
+	store := app.Store()
+	user, err := ReadSessionUser(c, store)
+	if err != nil {
+		return err
+	}
+
+	ok, _, err := app.Passwords().Verify(pass, user.Password())
+	if err != nil && err != UnknownHashError {
+		return err
+	}
+
+	if !ok {
+		return WrongPasswordError
+	}
+
+	err = store.RemoveTOTP(user.Id)
+	if err == NotFoundError {
+		return TOTPMissingError
+	}
+
+	if err != nil {
+		return err
+	}
+
+	data := IDData{
+		ID: user.Id.Hex(),
+	}
+	c.JSON(http.StatusOK, NewSuccessResponse(data))
+
+	return nil
+}
@@ -0,0 +1,282 @@
+package sj
+
+import (
+	"encoding/base32"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func SendTestLogin(env *TestEnv, code string) (LoginData, error) {
+	req := env.Request(`
+	{
+		"Data": {
+			"Name": "greatLover99",
+			"Password": "love!machine",
+			"Code": "` + code + `"
+		}
+	}`)
+
+	resp := req.Send("POST", "/login")
+
+	login := struct {
+		Status string
+		Err    string
+		Data   LoginData
+	}{}
+	err := json.Unmarshal(resp.Body.Bytes(), &login)
+	if err != nil {
+		return LoginData{}, err
+	}
+
+	if login.Status != "success" {
+		return LoginData{}, errors.New(login.Err)
+	}
+
+	return login.Data, nil
+}
+
+// Test vectors of RFC 6238 appendix B, cut to six digits
+func Test_TOTPCode_OK(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	vectors := []struct {
+		Time int64
+		Code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, v := range vectors {
+		code, err := TOTPCode(secret, TOTPStep(time.Unix(v.Time, 0)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if code != v.Code {
+			t.Fatal("Expect", v.Code, "was", code)
+		}
+	}
+}
+
+func Test_TOTPVerify_FailReplay(t *testing.T) {
+	store := NewTestStore(t)
+	defer CleanTestStore(store, t)
+
+	secret, err := NewTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1234567890, 0)
+	totp := TOTP{
+		UserID:        bson.NewObjectId(),
+		Secret:        secret,
+		Enabled:       true,
+		RecoveryCodes: []string{},
+	}
+	err = store.SaveTOTP(totp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := TOTPCode(secret, TOTPStep(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	step, ok := totp.Verify(code, now)
+	if !ok {
+		t.Fatal("Expect", code, "to be valid")
+	}
+
+	// Only the first of two logins with the same code saves the step
+	err = store.UseTOTPStep(totp.UserID, step)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.UseTOTPStep(totp.UserID, step)
+	if err != NotFoundError {
+		t.Fatal("Expect", NotFoundError, "was", err)
+	}
+
+	totp, err = store.ReadTOTP(totp.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, ok = totp.Verify(code, now)
+	if ok {
+		t.Fatal("Expect", code, "to be used")
+	}
+
+	later := now.Add(2 * TOTPPeriod * time.Second)
+	_, ok = totp.Verify(code, later)
+	if ok {
+		t.Fatal("Expect", code, "to be expired")
+	}
+}
+
+func Test_CheckSecondFactor_FailLocked(t *testing.T) {
+	store := NewTestStore(t)
+	defer CleanTestStore(store, t)
+
+	secret, err := NewTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	totp := TOTP{
+		UserID:        bson.NewObjectId(),
+		Secret:        secret,
+		Enabled:       true,
+		RecoveryCodes: []string{},
+	}
+	err = store.SaveTOTP(totp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1234567890, 0)
+	for i := 0; i < TOTPMaxFailures; i++ {
+		err := CheckSecondFactor(store, totp.UserID, "000000", now)
+		if err != TOTPCodeError {
+			t.Fatal("Expect", TOTPCodeError, "was", err)
+		}
+	}
+
+	code, err := TOTPCode(secret, TOTPStep(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = CheckSecondFactor(store, totp.UserID, code, now)
+	if err != TOTPLockedError {
+		t.Fatal("Expect", TOTPLockedError, "was", err)
+	}
+
+	later := now.Add(TOTPLockout)
+	code, err = TOTPCode(secret, TOTPStep(later))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = CheckSecondFactor(store, totp.UserID, code, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	totp, err = store.ReadTOTP(totp.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if totp.Failures != 0 {
+		t.Fatal("Expect no failures was", totp.Failures)
+	}
+}
+
+func Test_LoginTOTP_OK(t *testing.T) {
+	env := NewTestEnv(t)
+	defer env.Close()
+
+	now := time.Unix(1234567890, 0)
+	env.SetClock(now)
+
+	user := env.NewUser("greatLover99", "love!machine")
+	session := env.NewSession(user, "123")
+
+	req := env.Request("")
+	resp := req.SendWithToken("POST", "/account/totp", session.Token)
+
+	enroll := struct {
+		Status string
+		Data   TOTPEnrollData
+	}{}
+	err := json.Unmarshal(resp.Body.Bytes(), &enroll)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if enroll.Data.Secret == "" || enroll.Data.URI == "" {
+		t.Fatal("Expect a secret was", resp.Body)
+	}
+
+	// Not enabled before the first code
+	_, err = SendTestLogin(env, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := TOTPCode(enroll.Data.Secret, TOTPStep(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req = env.Request(`{"Data": {"Code": "` + code + `"}}`)
+	resp = req.SendWithToken("POST", "/account/totp/verify", session.Token)
+
+	confirm := struct {
+		Status string
+		Data   RecoveryCodesData
+	}{}
+	err = json.Unmarshal(resp.Body.Bytes(), &confirm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(confirm.Data.RecoveryCodes) != RecoveryCodes {
+		t.Fatal("Expect", RecoveryCodes, "recovery codes was", resp.Body)
+	}
+
+	_, err = SendTestLogin(env, "")
+	if err == nil || err.Error() != TOTPRequiredError.Error() {
+		t.Fatal("Expect", TOTPRequiredError, "was", err)
+	}
+
+	// The code of the enrollment is used up
+	_, err = SendTestLogin(env, code)
+	if err == nil || err.Error() != TOTPCodeError.Error() {
+		t.Fatal("Expect", TOTPCodeError, "was", err)
+	}
+
+	next, err := TOTPCode(enroll.Data.Secret, TOTPStep(now)+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = SendTestLogin(env, next)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recovery := confirm.Data.RecoveryCodes[0]
+	_, err = SendTestLogin(env, recovery)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = SendTestLogin(env, recovery)
+	if err == nil || err.Error() != TOTPCodeError.Error() {
+		t.Fatal("Expect", TOTPCodeError, "was", err)
+	}
+
+	req = env.Request(`{"Data": {"Password": "love!machine"}}`)
+	resp = req.SendWithToken("DELETE", "/account/totp", session.Token)
+	if resp.Code != http.StatusOK {
+		t.Fatal("Expect", http.StatusOK, "was", resp.Code, resp.Body)
+	}
+
+	_, err = SendTestLogin(env, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,314 @@
+package sj
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	MaxTitleLen        = 200
+	MaxResourceNameLen = 100
+	MaxURLLen          = 2048
+
+	// Layout of the air dates of the episodes
+	DateLayout = "2006-01-02"
+
+	InvalidFieldsCode = "invalid_fields"
+	EmptyFieldCode    = "empty_field"
+	TooLongCode       = "too_long"
+	InvalidURLCode    = "invalid_url"
+	OutOfRangeCode    = "out_of_range"
+)
+
+type (
+	// Validator collects every problem of a request instead of stopping
+	// at the first one. The field of a problem is the path in the Data
+	// of the request, like Image[0].URL.
+	Validator struct {
+		Fields []FieldError
+	}
+)
+
+func fieldPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+
+	return prefix + "." + key
+}
+
+func indexPath(prefix string, i int) string {
+	return fmt.Sprintf("%v[%v]", prefix, i)
+}
+
+func (v *Validator) Add(field, code, msg string) {
+	f := FieldError{
+		Field:   field,
+		Code:    code,
+		Message: msg,
+	}
+	v.Fields = append(v.Fields, f)
+}
+
+func (v *Validator) Missing(field string) {
+	v.Add(field, MissingFieldCode, fmt.Sprintf("%v is missing", field))
+}
+
+func (v *Validator) Wrong(field string) {
+	v.Add(field, WrongFieldCode, fmt.Sprintf("Wrong %v field", field))
+}
+
+func (v *Validator) Valid() bool {
+	return len(v.Fields) == 0
+}
+
+// Err returns nil without problems. A single problem keeps its code, more
+// problems are reported with InvalidFieldsCode.
+func (v *Validator) Err() error {
+	switch len(v.Fields) {
+	case 0:
+		return nil
+	case 1:
+		f := v.Fields[0]
+		return NewFieldError(f.Code, f.Field, f.Message)
+	}
+
+	msgs := []string{}
+	for _, f := range v.Fields {
+		msgs = append(msgs, f.Message)
+	}
+
+	e := NewAPIError(http.StatusBadRequest, InvalidFieldsCode, strings.Join(msgs, ", "))
+	e.Fields = v.Fields
+
+	return e
+}
+
+// Required adds a missing field error for an empty string
+func (v *Validator) Required(field, s string) {
+	if s == "" {
+		v.Missing(field)
+	}
+}
+
+// String checks a required string, maxLen 0 means any length
+func (v *Validator) String(field string, s *string, maxLen int) (string, bool) {
+	if s == nil {
+		v.Missing(field)
+		return "", false
+	}
+
+	if maxLen > 0 && utf8.RuneCountInString(*s) > maxLen {
+		msg := fmt.Sprintf("%v must have at most %v characters", field, maxLen)
+		v.Add(field, TooLongCode, msg)
+		return "", false
+	}
+
+	return *s, true
+}
+
+// RequiredString checks a string which has to be given and not empty
+func (v *Validator) RequiredString(field string, s *string) string {
+	str, ok := v.String(field, s, 0)
+	if ok {
+		v.Required(field, str)
+	}
+
+	return str
+}
+
+func (v *Validator) NotEmpty(field, s string) {
+	if strings.TrimSpace(s) == "" {
+		v.Add(field, EmptyFieldCode, fmt.Sprintf("%v is empty", field))
+	}
+}
+
+// Int checks a required number which is not negative
+func (v *Validator) Int(field string, n *int) (int, bool) {
+	if n == nil {
+		v.Missing(field)
+		return 0, false
+	}
+
+	if *n < 0 {
+		v.Add(field, OutOfRangeCode, fmt.Sprintf("%v must not be negative", field))
+		return 0, false
+	}
+
+	return *n, true
+}
+
+// OptionalInt checks a number which is not negative, 0 if it is missing
+func (v *Validator) OptionalInt(field string, n *int) int {
+	if n == nil {
+		return 0
+	}
+
+	i, _ := v.Int(field, n)
+
+	return i
+}
+
+// Date checks a date like 2006-01-02, zero if it is missing
+func (v *Validator) Date(field string, s *string) time.Time {
+	if s == nil {
+		return time.Time{}
+	}
+
+	t, err := time.Parse(DateLayout, *s)
+	if err != nil {
+		msg := fmt.Sprintf("%v must be a date like %v", field, DateLayout)
+		v.Add(field, WrongFieldCode, msg)
+		return time.Time{}
+	}
+
+	return t
+}
+
+// Order checks an episode order, empty if it is missing
+func (v *Validator) Order(field string, s *string) string {
+	if s == nil {
+		return ""
+	}
+
+	if *s == "" || !ValidOrder(*s) {
+		msg := fmt.Sprintf("%v must be %v, %v or %v", field, SeasonOrder, AbsoluteOrder, AiredOrder)
+		v.Add(field, WrongFieldCode, msg)
+		return ""
+	}
+
+	return *s
+}
+
+// URL accepts absolute http and https URLs
+func (v *Validator) URL(field, s string) {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		v.Add(field, InvalidURLCode, fmt.Sprintf("%v is no valid URL", field))
+	}
+}
+
+// Resource checks a resource, the URL of an empty resource is not checked.
+// The bool is false if the resource has problems.
+func (v *Validator) Resource(body ResourceBody, field string) (Resource, bool) {
+	name, nameOK := v.String(fieldPath(field, "Name"), body.Name, MaxResourceNameLen)
+	u, urlOK := v.String(fieldPath(field, "URL"), body.URL, MaxURLLen)
+
+	r := Resource{
+		Name: name,
+		URL:  u,
+	}
+
+	if urlOK && !EmptyResource(r) {
+		n := len(v.Fields)
+		v.URL(fieldPath(field, "URL"), u)
+		urlOK = n == len(v.Fields)
+	}
+
+	return r, nameOK && urlOK
+}
+
+// Resources checks a required resource list, an empty resource in the
+// list is an error.
+func (v *Validator) Resources(body *ResourcesBody, field string) Resources {
+	if body == nil {
+		v.Missing(field)
+		return Resources{}
+	}
+
+	if *body == nil {
+		v.Wrong(field)
+		return Resources{}
+	}
+
+	l := Resources{}
+	for i, item := range *body {
+		path := indexPath(field, i)
+		r, ok := v.Resource(item, path)
+		if ok && EmptyResource(r) {
+			v.NotEmpty(fieldPath(path, "URL"), r.URL)
+		}
+		l = append(l, r)
+	}
+
+	return l
+}
+
+// ResourceChange returns the change of a resource field for ChangeSeries,
+// nil is no change.
+func (v *Validator) ResourceChange(body *ResourceChangeBody, field string) interface{} {
+	if body == nil {
+		return nil
+	}
+
+	path := field
+	if body.Op != "" {
+		path = fieldPath(field, body.Op)
+	}
+
+	if body.Op == "Remove" {
+		return RemoveResources(v.RemovedResources(&body.Resources, path))
+	}
+
+	l := v.Resources(&body.Resources, path)
+	if body.Op == "Append" {
+		return AppendResources(l)
+	}
+
+	return l
+}
+
+// RemovedResources checks the resources of a Remove change. They only have
+// to name a stored entry, so older or malformed URLs can be removed too.
+func (v *Validator) RemovedResources(body *ResourcesBody, field string) Resources {
+	if body == nil {
+		v.Missing(field)
+		return Resources{}
+	}
+
+	if *body == nil {
+		v.Wrong(field)
+		return Resources{}
+	}
+
+	l := Resources{}
+	for i, item := range *body {
+		path := indexPath(field, i)
+		name, nameOK := v.String(fieldPath(path, "Name"), item.Name, 0)
+		u, urlOK := v.String(fieldPath(path, "URL"), item.URL, 0)
+
+		r := Resource{
+			Name: name,
+			URL:  u,
+		}
+		if nameOK && urlOK && EmptyResource(r) {
+			v.NotEmpty(fieldPath(path, "URL"), r.URL)
+		}
+		l = append(l, r)
+	}
+
+	return l
+}
+
+// Episode checks an episode, the title may be empty if it is not known yet.
+// Part, Absolute and Aired are optional.
+func (v *Validator) Episode(body EpisodeBody, field string) Episode {
+	title, _ := v.String(fieldPath(field, "Title"), body.Title, MaxTitleLen)
+	session, _ := v.Int(fieldPath(field, "Session"), body.Session)
+	episode, _ := v.Int(fieldPath(field, "Episode"), body.Episode)
+
+	e := Episode{
+		Title:    title,
+		Session:  session,
+		Episode:  episode,
+		Part:     v.OptionalInt(fieldPath(field, "Part"), body.Part),
+		Absolute: v.OptionalInt(fieldPath(field, "Absolute"), body.Absolute),
+		Aired:    v.Date(fieldPath(field, "Aired"), body.Aired),
+	}
+
+	return e
+}
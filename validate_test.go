@@ -0,0 +1,172 @@
+package sj
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func EqualFieldErrors(err error, expect []FieldError) bool {
+	apiErr, ok := err.(*APIError)
+	if !ok || len(apiErr.Fields) != len(expect) {
+		return false
+	}
+
+	for i, f := range apiErr.Fields {
+		if f.Field != expect[i].Field || f.Code != expect[i].Code {
+			return false
+		}
+	}
+
+	return true
+}
+
+func Test_ParseNewSeriesRequest_FailAllFields(t *testing.T) {
+	data := `
+	{
+		"Data": {
+			"Title": " ",
+			"Image": [{"Name": "kinox.to", "URL": "kinox.to/1"}],
+			"Desc": [{"Name": "` + strings.Repeat("x", MaxResourceNameLen+1) + `", "URL": "http://imdb.com"}],
+			"Episodes": "http://imdb.com",
+			"Portal": [{"Name": "kinox.to"}]
+		}
+	}`
+
+	req, err := http.NewRequest("POST", "/", bytes.NewReader([]byte(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ginCtx := gin.Context{}
+	ginCtx.Request = req
+
+	_, err = ParseNewSeriesRequest(&ginCtx)
+
+	expect := []FieldError{
+		{Field: "Title", Code: EmptyFieldCode},
+		{Field: "Image[0].URL", Code: InvalidURLCode},
+		{Field: "Desc[0].Name", Code: TooLongCode},
+		{Field: "Episodes", Code: WrongFieldCode},
+		{Field: "Portal[0].URL", Code: MissingFieldCode},
+	}
+	if !EqualFieldErrors(err, expect) {
+		t.Fatal("Expect", expect, "was", err.(*APIError).Fields)
+	}
+}
+
+func Test_ParseNewSeriesRequest_OldClientResource(t *testing.T) {
+	data := `
+	{
+		"Data": {
+			"Title": "Narcos",
+			"Image": {"Name": "", "URL": ""},
+			"Desc": {"Name": "imdb.com", "URL": "http://www.imdb.com/title/tt2707408"},
+			"Episodes": [],
+			"Portal": []
+		}
+	}`
+
+	req, err := http.NewRequest("POST", "/", bytes.NewReader([]byte(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ginCtx := gin.Context{}
+	ginCtx.Request = req
+
+	series, err := ParseNewSeriesRequest(&ginCtx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(series.Image) != 0 || len(series.Desc) != 1 {
+		t.Fatal("Expect no image and one description was", series)
+	}
+}
+
+func Test_ParseNewEpisodeBatchRequest_FailAllFields(t *testing.T) {
+	data := `
+	{
+		"Data": [
+			{"Title": "Pilot", "Session": 1, "Episode": 1},
+			{"Title": "", "Session": -1, "Episode": 2},
+			{"Session": 1, "Episode": 3}
+		]
+	}`
+
+	req, err := http.NewRequest("POST", "/", bytes.NewReader([]byte(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ParseNewEpisodeBatchRequest(req)
+
+	expect := []FieldError{
+		{Field: "[1].Session", Code: OutOfRangeCode},
+		{Field: "[2].Title", Code: MissingFieldCode},
+	}
+	if !EqualFieldErrors(err, expect) {
+		t.Fatal("Expect", expect, "was", err)
+	}
+}
+
+func Test_ParseNewEpisodeRequest_FailOrderFields(t *testing.T) {
+	body := `{"Data": {"Title": "Pilot", "Session": 1, "Episode": 1, "Part": -1, "Aired": "20.08.2015"}}`
+
+	req, err := http.NewRequest("POST", "/", bytes.NewReader([]byte(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ParseNewEpisodeRequest(req)
+
+	expect := []FieldError{
+		{Field: "Part", Code: OutOfRangeCode},
+		{Field: "Aired", Code: WrongFieldCode},
+	}
+	if !EqualFieldErrors(err, expect) {
+		t.Fatal("Expect", expect, "was", err)
+	}
+}
+
+func Test_ParseChangeSeriesRequest_RemoveMalformedURL(t *testing.T) {
+	body := `{"Data": {"Portal": {"Remove": [{"Name": "kinox.to", "URL": "kinox.to/` + strings.Repeat("x", MaxURLLen) + `"}]}}}`
+
+	req, err := http.NewRequest("POST", "/", bytes.NewReader([]byte(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	change, err := ParseChangeSeriesRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, ok := change.Portal.(RemoveResources)
+	if !ok || len(l) != 1 || l[0].Name != "kinox.to" {
+		t.Fatal("Expect the malformed resource to be removed was", change.Portal)
+	}
+}
+
+func Test_ParseChangeSeriesRequest_FailRemoveEmpty(t *testing.T) {
+	body := `{"Data": {"Portal": {"Remove": [{"Name": "", "URL": ""}, {"Name": "kinox.to"}]}}}`
+
+	req, err := http.NewRequest("POST", "/", bytes.NewReader([]byte(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = ParseChangeSeriesRequest(req)
+
+	expect := []FieldError{
+		{Field: "Portal.Remove[0].URL", Code: EmptyFieldCode},
+		{Field: "Portal.Remove[1].URL", Code: MissingFieldCode},
+	}
+	if !EqualFieldErrors(err, expect) {
+		t.Fatal("Expect", expect, "was", err)
+	}
+}